@@ -0,0 +1,73 @@
+package traffic
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	gAckTimeout    = 1 * time.Second
+	gMaxRetransmit = 3
+)
+
+type pendingCommand struct {
+	AGVCommand
+	sentAt  time.Time
+	retries int
+}
+
+func (v *AGV) issueCommand(cmd AGVCommand, now time.Time) {
+	v.seq++
+	cmd.Seq = v.seq
+	v.Command = cmd
+	v.pending = append(v.pending, pendingCommand{AGVCommand: cmd, sentAt: now})
+	v.sent = append(v.sent, cmd)
+	if v.held != nil && v.heldSeq == 0 {
+		v.heldSeq = cmd.Seq
+	}
+}
+
+func (v *AGV) ackCommand(code int) {
+	i := 0
+	for i < len(v.pending) && v.pending[i].Seq <= code {
+		i++
+	}
+	v.pending = v.pending[i:]
+
+	if v.heldSeq > 0 && code >= v.heldSeq {
+		log.Printf("<AGV.ackCommand> AGV %d acked command %d, release the claim of replaced routes\n", v.ID, code)
+		v.held, v.heldSeq = nil, 0
+	}
+}
+
+func (v *AGV) Pending() []AGVCommand {
+	cmds := make([]AGVCommand, 0, len(v.pending))
+	for _, p := range v.pending {
+		cmds = append(cmds, p.AGVCommand)
+	}
+	return cmds
+}
+
+func (v *AGV) checkAck(now time.Time) (isRetransmit bool) {
+	if v.RunStatus != Run || len(v.pending) == 0 {
+		return false
+	}
+
+	p := &v.pending[len(v.pending)-1]
+	if now.Sub(p.sentAt) < gAckTimeout {
+		return false
+	}
+
+	if p.retries >= gMaxRetransmit {
+		log.Printf("<AGV.checkAck> AGV %d no ack for command %d after %d retransmissions\n", v.ID, p.Seq, p.retries)
+		v.fault(ECNoAck, "no ack")
+		return false
+	}
+
+	p.retries++
+	p.sentAt = now
+	v.Command = p.AGVCommand
+	v.sent = v.Pending()
+	log.Printf("<AGV.checkAck> AGV %d retransmit command %d, retry %d\n", v.ID, p.Seq, p.retries)
+	return true
+}
@@ -0,0 +1,60 @@
+package traffic
+
+import (
+	"testing"
+	"time"
+	"traffic/util"
+)
+
+func TestController_Ack(t *testing.T) {
+	c := NewController()
+	c.Register(1)
+	c.SetRoutes(1, straightRoutes(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 10000, Y: 0}))
+
+	results := c.Update([]AGVStatus{{ID: 1, MotionStatus: MSStop, Pos: util.IntPoint{X: 0, Y: 0}}})
+	seq := results[0].Command.Seq
+	v, _ := c.AGV(1)
+	if seq == 0 || len(v.Pending()) != 1 {
+		t.Fatalf("want command %d pending, result %v", seq, v.Pending())
+	}
+
+	c.Update([]AGVStatus{{ID: 1, MotionStatus: MSStraight, Pos: util.IntPoint{X: 100, Y: 0}, ControlCode: seq}})
+	if len(v.Pending()) != 0 {
+		t.Errorf("want command %d acked, result %v", seq, v.Pending())
+	}
+}
+
+func TestController_AckTimeout(t *testing.T) {
+	c := NewController()
+	clock := time.Now()
+	c.SetClock(func() time.Time { return clock })
+	c.Register(1)
+	c.SetRoutes(1, straightRoutes(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 10000, Y: 0}))
+
+	status := []AGVStatus{{ID: 1, MotionStatus: MSStop, Pos: util.IntPoint{X: 0, Y: 0}}}
+	seq := c.Update(status)[0].Command.Seq
+
+	if c.Update(status)[0].IsRetransmit {
+		t.Errorf("want no retransmit before %s", gAckTimeout)
+	}
+
+	retransmits := 0
+	var last AGVResult
+	for i := 0; i < (gMaxRetransmit+1)*10; i++ {
+		clock = clock.Add(gAckTimeout / 10)
+		last = c.Update(status)[0]
+		if last.IsRetransmit {
+			retransmits++
+			if last.Command.Seq != seq {
+				t.Errorf("want retransmit command %d, result %d", seq, last.Command.Seq)
+			}
+		}
+	}
+
+	if retransmits != gMaxRetransmit {
+		t.Errorf("want %d retransmissions, result %d", gMaxRetransmit, retransmits)
+	}
+	if last.RunStatus != Fault || last.ErrorCode != ECNoAck {
+		t.Errorf("want fault for no ack, result %v", last)
+	}
+}
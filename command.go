@@ -0,0 +1,116 @@
+package traffic
+
+import (
+	"fmt"
+	"traffic/route"
+	"traffic/util"
+)
+
+// CommandRefs layout by sub route type, the start point is where the AGV
+// already stands so it is never packed. Astern is carried by Heading, which
+// is the body heading and so opposite to the travel direction:
+//
+//	Straight  unused
+//	QTurn     MoveType, Corner.X, Corner.Y, RefParams[0..2]
+//	Oblique   MoveType, RefParams[0] (lateral offset)
+//	UTurn     MoveType, P0.X, P0.Y, P1.X, P1.Y, RefParams[0..1]
+//	STurn     MoveType, P0.X, P0.Y, P1.X, P1.Y, RefParams[0..1]
+//	Linkage   MoveType, RefParams[0..5]
+const (
+	CRMoveType = iota
+	CRRef1
+	CRRef2
+	CRRef3
+	CRRef4
+	CRRef5
+	CRRef6
+)
+
+func EncodeCommand(sr route.SubRoute) (cmd AGVCommand, err error) {
+	cmd = AGVCommand{
+		Type:               sr.Type,
+		Heading:            int(sr.HeadingOnSubRoute(sr.End, sr.IsAstern)),
+		Target:             sr.End,
+		MaxStraightSpeed:   sr.MaxSpeed,
+		MaxSpecialSpeed:    sr.MaxSpeed,
+		IsNeedAccurateStop: sr.IsEndStop,
+	}
+	refs := &cmd.CommandRefs
+
+	switch sr.Type {
+	case route.Straight:
+
+	case route.QTurn:
+		refs[CRMoveType] = sr.MoveType
+		refs[CRRef1], refs[CRRef2] = sr.RefPoints[0].X, sr.RefPoints[0].Y
+		for i := 0; i < 3; i++ {
+			refs[CRRef3+i] = int(sr.RefParams[i])
+		}
+
+	case route.Oblique:
+		refs[CRMoveType] = sr.MoveType
+		refs[CRRef1] = int(sr.RefParams[0])
+
+	case route.UTurn, route.STurn:
+		refs[CRMoveType] = sr.MoveType
+		refs[CRRef1], refs[CRRef2] = sr.RefPoints[0].X, sr.RefPoints[0].Y
+		refs[CRRef3], refs[CRRef4] = sr.RefPoints[1].X, sr.RefPoints[1].Y
+		refs[CRRef5], refs[CRRef6] = int(sr.RefParams[0]), int(sr.RefParams[1])
+
+	case route.Linkage:
+		refs[CRMoveType] = sr.MoveType
+		for i := 0; i < 6; i++ {
+			refs[CRRef1+i] = int(sr.RefParams[i])
+		}
+
+	default:
+		return AGVCommand{}, fmt.Errorf("Can't encode sub route type %d", sr.Type)
+	}
+
+	return cmd, nil
+}
+
+func DecodeCommand(cmd AGVCommand, start util.IntPoint) (sr route.SubRoute, err error) {
+	sr = route.SubRoute{
+		Type:      cmd.Type,
+		Start:     start,
+		End:       cmd.Target,
+		MaxSpeed:  cmd.MaxSpecialSpeed,
+		IsEndStop: cmd.IsNeedAccurateStop,
+	}
+	refs := cmd.CommandRefs
+
+	switch cmd.Type {
+	case route.Straight:
+		sr.MaxSpeed = cmd.MaxStraightSpeed
+
+	case route.QTurn:
+		sr.MoveType = refs[CRMoveType]
+		sr.RefPoints[0] = util.IntPoint{X: refs[CRRef1], Y: refs[CRRef2]}
+		for i := 0; i < 3; i++ {
+			sr.RefParams[i] = int32(refs[CRRef3+i])
+		}
+
+	case route.Oblique:
+		sr.MoveType = refs[CRMoveType]
+		sr.RefParams[0] = int32(refs[CRRef1])
+
+	case route.UTurn, route.STurn:
+		sr.MoveType = refs[CRMoveType]
+		sr.RefPoints[0] = util.IntPoint{X: refs[CRRef1], Y: refs[CRRef2]}
+		sr.RefPoints[1] = util.IntPoint{X: refs[CRRef3], Y: refs[CRRef4]}
+		sr.RefParams[0], sr.RefParams[1] = int32(refs[CRRef5]), int32(refs[CRRef6])
+
+	case route.Linkage:
+		sr.MoveType = refs[CRMoveType]
+		for i := 0; i < 6; i++ {
+			sr.RefParams[i] = int32(refs[CRRef1+i])
+		}
+
+	default:
+		return route.SubRoute{}, fmt.Errorf("Can't decode command type %d", cmd.Type)
+	}
+
+	sr.IsAstern = cmd.Heading != int(sr.HeadingOnSubRoute(sr.End, false))
+	return sr, nil
+}
@@ -0,0 +1,54 @@
+package traffic
+
+import (
+	"testing"
+	"traffic/route"
+	"traffic/util"
+)
+
+func TestEncodeCommand_RoundTrip(t *testing.T) {
+	srs := []route.SubRoute{
+		{Type: route.Straight, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 5000, Y: 0}, MaxSpeed: 1500},
+		{Type: route.QTurn, MoveType: 10, Start: util.IntPoint{X: 10000, Y: 0}, End: util.IntPoint{X: 11300, Y: 1400}, MaxSpeed: 500,
+			RefParams: [6]int32{400, 700, 1300}, RefPoints: [2]util.IntPoint{{X: 11300, Y: 0}}},
+		{Type: route.Oblique, MoveType: 26, Start: util.IntPoint{X: 5000, Y: 0}, End: util.IntPoint{X: 7500, Y: 1200}, MaxSpeed: 500,
+			RefParams: [6]int32{1200}, IsEndStop: true},
+		{Type: route.UTurn, MoveType: 30, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 0, Y: 3000}, MaxSpeed: 300,
+			RefParams: [6]int32{1500, 200}, RefPoints: [2]util.IntPoint{{X: 2000, Y: 0}, {X: 2000, Y: 3000}}},
+		{Type: route.STurn, MoveType: 40, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 6000, Y: 1000}, MaxSpeed: 300,
+			RefParams: [6]int32{2000}, RefPoints: [2]util.IntPoint{{X: 2000, Y: 0}, {X: 4000, Y: 1000}}},
+		{Type: route.Straight, Start: util.IntPoint{X: 5000, Y: 0}, End: util.IntPoint{X: 0, Y: 0}, MaxSpeed: 300, IsAstern: true},
+		{Type: route.Linkage, MoveType: 90, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 8000, Y: 0}, MaxSpeed: 300,
+			RefParams: [6]int32{1, 2, 3000, 4, 5, 6}},
+	}
+
+	for _, sr := range srs {
+		cmd, err := EncodeCommand(sr)
+		if err != nil {
+			t.Fatalf("encode %s: %s", sr, err)
+		}
+		if cmd.Type != sr.Type || !cmd.Target.Equal(sr.End) || cmd.IsNeedAccurateStop != sr.IsEndStop {
+			t.Errorf("want command for %s, result %+v", sr, cmd)
+		}
+		if cmd.Heading != int(sr.HeadingOnSubRoute(sr.End, sr.IsAstern)) {
+			t.Errorf("want heading %d, result %d", int(sr.HeadingOnSubRoute(sr.End, sr.IsAstern)), cmd.Heading)
+		}
+
+		result, err := DecodeCommand(cmd, sr.Start)
+		if err != nil {
+			t.Fatalf("decode %+v: %s", cmd, err)
+		}
+		if result != sr {
+			t.Errorf("want round trip %s, result %s", sr, result)
+		}
+	}
+}
+
+func TestEncodeCommand_Invalid(t *testing.T) {
+	if _, err := EncodeCommand(route.SubRoute{Type: route.Invalid}); err == nil {
+		t.Error("want error for invalid sub route")
+	}
+	if _, err := DecodeCommand(AGVCommand{Type: route.Invalid}, util.IntPoint{}); err == nil {
+		t.Error("want error for invalid command")
+	}
+}
@@ -0,0 +1,344 @@
+package traffic
+
+import (
+	"log"
+	"math"
+	"time"
+	"traffic/forbidden"
+	"traffic/legume"
+	"traffic/route"
+	"traffic/util"
+	"traffic/vehicle"
+)
+
+const gLegumeSize = 5000
+
+type Controller struct {
+	agvs      map[int]*AGV
+	order     []int
+	waitFor   waitForGraph
+	deadlocks []Deadlock
+	resolver  DeadlockResolver
+	clock     func() time.Time
+	now       time.Time
+	linked    map[int]bool
+}
+
+func NewController() *Controller {
+	return &Controller{
+		agvs:     make(map[int]*AGV),
+		resolver: PriorityResolver{},
+		clock:    time.Now,
+	}
+}
+
+// SetClock replaces the clock the ack timeout is measured with, a simulation passes its own time.
+func (c *Controller) SetClock(clock func() time.Time) {
+	c.clock = clock
+}
+
+func (c *Controller) Register(id int) bool {
+	return c.RegisterModel(id, &vehicle.Default)
+}
+
+func (c *Controller) RegisterModel(id int, m *vehicle.Model) bool {
+	log.Printf("<Controller.Register> id %d, model %s\n", id, m.Name)
+	defer log.Println("<Controller.Register> exit")
+
+	if _, ok := c.agvs[id]; ok {
+		log.Printf("AGV %d already exist\n", id)
+		return false
+	}
+
+	v := &AGV{ID: id, Model: m, hooks: newStateHooks()}
+	v.Transit(Idle, "register")
+	c.agvs[id] = v
+	c.order = append(c.order, id)
+	return true
+}
+
+func (c *Controller) Unregister(id int) bool {
+	log.Printf("<Controller.Unregister> id %d\n", id)
+	defer log.Println("<Controller.Unregister> exit")
+
+	if _, ok := c.agvs[id]; !ok {
+		log.Printf("can't find AGV %d\n", id)
+		return false
+	}
+
+	delete(c.agvs, id)
+	for i, v := range c.order {
+		if v == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (c *Controller) AGV(id int) (*AGV, bool) {
+	v, ok := c.agvs[id]
+	return v, ok
+}
+
+func (c *Controller) SetRoutes(id int, routes []route.SubRoute) bool {
+	log.Printf("<Controller.SetRoutes> id %d, %d sub routes\n", id, len(routes))
+	defer log.Println("<Controller.SetRoutes> exit")
+
+	v, ok := c.agvs[id]
+	if !ok {
+		log.Printf("can't find AGV %d\n", id)
+		return false
+	}
+
+	if v.RunStatus == Run || v.RunStatus == Pause {
+		log.Printf("AGV %d is %s, can't set routes\n", id, RunStatusName(v.RunStatus))
+		return false
+	}
+	if v.RunStatus == Fault {
+		log.Printf("AGV %d is Fault with error code %d, clear it before setting routes\n", id, v.ErrorCode)
+		return false
+	}
+
+	v.Routes = routes
+	v.Reset()
+	if len(routes) == 0 {
+		return true
+	}
+
+	v.Target.Index = len(routes)
+	v.Target.Position = routes[len(routes)-1].End
+	if err := v.Transit(Run, "set routes"); err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
+
+func (c *Controller) Update(statuses []AGVStatus) []AGVResult {
+	c.now = c.clock()
+	for _, s := range statuses {
+		v, ok := c.agvs[s.ID]
+		if !ok {
+			log.Printf("<Controller.Update> can't find AGV %d, status %s\n", s.ID, s)
+			continue
+		}
+		v.updateStatus(s)
+	}
+
+	for _, id := range c.order {
+		v := c.agvs[id]
+		if v.RunStatus == Run {
+			v.UpdateCurrentMark()
+			if v.Current.Index >= v.Target.Index && v.IsArrivalWithTolerance(v.Target.Position) {
+				log.Printf("<Controller.Update> AGV %d arrived at (%d, %d)\n", id, v.Target.Position.X, v.Target.Position.Y)
+				v.Routes = nil
+				v.Reset()
+			}
+		}
+
+		if err := v.updateLegume(); err != nil {
+			log.Printf("<Controller.Update> AGV %d legume: %s\n", id, err)
+			v.fault(ECRoute, "legume")
+		}
+	}
+
+	c.waitFor = make(waitForGraph)
+	c.linked = make(map[int]bool)
+	for _, id := range c.order {
+		v := c.agvs[id]
+		if v.RunStatus == Run && !c.linked[id] {
+			c.decideClaim(v)
+			v.updateCommand(c.now)
+		}
+	}
+	c.detectDeadlock()
+	c.resolveDeadlock()
+
+	results := make([]AGVResult, 0, len(c.order))
+	for _, id := range c.order {
+		v := c.agvs[id]
+		isRetransmit := v.checkAck(c.now)
+		results = append(results, AGVResult{ID: v.ID, RunStatus: v.RunStatus, Command: v.Command, Commands: v.sent,
+			ErrorCode: v.ErrorCode, IsRetransmit: isRetransmit})
+		v.sent = nil
+	}
+
+	return results
+}
+
+func (v *AGV) updateStatus(s AGVStatus) {
+	v.Heading = s.Heading
+	v.Speed = s.Speed
+	v.MotionStatus = s.MotionStatus
+	v.ControlCode = s.ControlCode
+	v.ackCommand(s.ControlCode)
+	v.Priority = s.Priority
+	v.Position = s.Pos.ToFloatPoint()
+	v.Orientation = util.Degree(s.Heading).ToDirection()
+}
+
+func (v *AGV) updateLegume() error {
+	if v.leg == nil {
+		v.leg = &legume.Legume{}
+		v.leg.Init(gLegumeSize)
+	}
+
+	m := v.model()
+	v.leg.SetModel(m)
+	v.leg.Clear()
+	v.leg.GrowCenter(v.Position, m.HalfLength, m.HalfWidth, util.Degree(v.Heading))
+	v.leg.Reset()
+
+	if v.RunStatus != Run && v.RunStatus != Pause {
+		return nil
+	}
+
+	for i := v.Current.Index; i < v.Claim.Index; i++ {
+		if err := v.leg.GrowSubRoute(v.Routes[i]); err != nil {
+			return err
+		}
+	}
+	for _, sr := range v.held {
+		if err := v.leg.GrowSubRoute(sr); err != nil {
+			return err
+		}
+	}
+	v.leg.ClaimTrying()
+	return nil
+}
+
+func (c *Controller) decideClaim(v *AGV) {
+	if v.Claim.Index >= len(v.Routes) {
+		return
+	}
+	if v.Routes[v.Claim.Index].Type == route.Linkage {
+		c.decideLinkageClaim(v)
+		return
+	}
+
+	end := v.Claim.Index
+	for end < len(v.Routes)-1 && v.Routes[end].IsContinuousLockWithNext && !v.Routes[end].IsEndStop &&
+		v.Routes[end+1].Type != route.Linkage {
+		end++
+	}
+
+	for i := v.Claim.Index; i <= end; i++ {
+		if err := v.leg.GrowSubRoute(v.Routes[i]); err != nil {
+			log.Printf("<Controller.decideClaim> AGV %d sub route %d: %s\n", v.ID, i, err)
+			v.leg.ResetTrying()
+			v.fault(ECRoute, "claim")
+			return
+		}
+	}
+	v.Trying = route.Mark{Index: end + 1, Position: v.Routes[end].End}
+
+	if c.isTryingBlocked(v) {
+		failed := v.TryFailedCount + 1
+		v.ResetTrying()
+		v.TryFailedCount = failed
+		return
+	}
+
+	v.leg.ClaimTrying()
+	v.Claim = v.Trying
+	v.TryFailedCount = 0
+}
+
+func (c *Controller) isTryingBlocked(v *AGV) bool {
+	start, end := v.leg.Trying()
+	isBlocked := false
+
+	for _, id := range c.order {
+		q := c.agvs[id]
+		if q == v || q.leg == nil || v.isLinkedWith(q.ID) || q.isLinkedWith(v.ID) {
+			continue
+		}
+
+		qStart, qEnd := q.leg.Claimed()
+		if res, r, j := v.leg.IsOverlapWithLegume(start, end, q.leg, qStart, qEnd); res {
+			log.Printf("<Controller.isTryingBlocked> AGV %d blocked by AGV %d, failed %d\n", v.ID, q.ID, v.TryFailedCount+1)
+			c.waitFor.add(WaitFor{
+				ID:               v.ID,
+				BlockerID:        q.ID,
+				BeanIndex:        legume.BeanIndex(r),
+				BlockerBeanIndex: legume.BeanIndex(j),
+				Bean:             legume.BeanOBB(r),
+				BlockerBean:      legume.BeanOBB(j),
+			})
+			isBlocked = true
+		}
+	}
+
+	if res, fid := forbidden.IsOverlapWithLegume(v.ID, v.leg.Body(), v.leg, start, end); res {
+		log.Printf("<Controller.isTryingBlocked> AGV %d blocked by forbidden area %d, failed %d\n", v.ID, fid, v.TryFailedCount+1)
+		isBlocked = true
+	}
+
+	return isBlocked
+}
+
+func (v *AGV) updateCommand(now time.Time) {
+	if v.Claim.Index <= v.CommandRM.Index || v.Claim.Index == 0 {
+		return
+	}
+
+	m := v.model()
+	straight, special := v.peakSpeeds()
+	for i := v.CommandRM.Index; i < v.Claim.Index; i++ {
+		sr := v.Routes[i]
+		cmd, err := EncodeCommand(sr)
+		if err != nil {
+			log.Printf("<AGV.updateCommand> AGV %d sub route %d: %s\n", v.ID, i, err)
+			return
+		}
+
+		// the peaks span the claim, each command is held to its own sub route
+		limit := m.Limit(sr).MaxSpeed
+		if sr.Type == route.Straight {
+			cmd.MaxStraightSpeed, cmd.MaxSpecialSpeed = minSpeed(straight, limit), special
+		} else {
+			cmd.MaxStraightSpeed, cmd.MaxSpecialSpeed = straight, minSpeed(special, limit)
+		}
+		cmd.IsNeedAccurateStop = sr.IsEndStop || i == len(v.Routes)-1
+		v.issueCommand(cmd, now)
+		v.CommandRM = route.Mark{Index: i + 1, Position: sr.End}
+	}
+}
+
+func minSpeed(v, limit int) int {
+	if limit > 0 && (v <= 0 || v > limit) {
+		return limit
+	}
+	return v
+}
+
+func (v *AGV) peakSpeeds() (straight, special int) {
+	m := v.model()
+	srs := make([]route.SubRoute, 0, v.Claim.Index-v.Current.Index)
+	for _, sr := range v.Routes[v.Current.Index:v.Claim.Index] {
+		srs = append(srs, m.Limit(sr))
+	}
+	p := route.NewProfile(srs, float64(v.Speed), 0, 0)
+	for _, seg := range p.Segments {
+		peak := int(math.Ceil(seg.PeakSpeed))
+		if srs[seg.Index].Type == route.Straight && peak > straight {
+			straight = peak
+		} else if srs[seg.Index].Type != route.Straight && peak > special {
+			special = peak
+		}
+	}
+
+	if v.linkSpeed > 0 && v.Routes[v.Claim.Index-1].Type == route.Linkage && special > v.linkSpeed {
+		special = v.linkSpeed
+	}
+
+	last := v.Routes[v.Claim.Index-1].MaxSpeed
+	if straight == 0 {
+		straight = last
+	}
+	if special == 0 {
+		special = last
+	}
+	return straight, special
+}
@@ -0,0 +1,158 @@
+package traffic
+
+import (
+	"testing"
+	"traffic/forbidden"
+	"traffic/route"
+	"traffic/util"
+	"traffic/vehicle"
+)
+
+func straightRoutes(start, end util.IntPoint) []route.SubRoute {
+	return []route.SubRoute{{Type: route.Straight, Start: start, End: end, MaxSpeed: 1000, IsEndStop: true}}
+}
+
+func TestController_Register(t *testing.T) {
+	c := NewController()
+	if !c.Register(1) {
+		t.Error("register AGV 1 failed")
+	}
+	if c.Register(1) {
+		t.Error("register AGV 1 twice should fail")
+	}
+	if !c.Unregister(1) || c.Unregister(1) {
+		t.Error("unregister AGV 1 wrong")
+	}
+}
+
+func TestController_RegisterModel(t *testing.T) {
+	c := NewController()
+	m := vehicle.Default
+	m.Name, m.MaxSpeed = "slow", 500
+	c.RegisterModel(1, &m)
+	c.SetRoutes(1, straightRoutes(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 20000, Y: 0}))
+
+	results := c.Update([]AGVStatus{{ID: 1, Heading: 0, MotionStatus: MSStop, Pos: util.IntPoint{X: 0, Y: 0}}})
+	if cmd := results[0].Command; cmd.MaxStraightSpeed != 500 {
+		t.Errorf("want straight speed limited to 500 by model, result %v", cmd)
+	}
+}
+
+func TestController_Update(t *testing.T) {
+	c := NewController()
+	c.Register(1)
+	c.Register(2)
+
+	c.Update([]AGVStatus{
+		{ID: 1, MotionStatus: MSStop, Pos: util.IntPoint{X: 0, Y: 0}},
+		{ID: 2, MotionStatus: MSStop, Pos: util.IntPoint{X: 20000, Y: 0}},
+	})
+
+	if !c.SetRoutes(1, straightRoutes(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 10000, Y: 0})) {
+		t.Fatal("set routes failed")
+	}
+
+	results := c.Update([]AGVStatus{{ID: 1, MotionStatus: MSStop, Pos: util.IntPoint{X: 0, Y: 0}}})
+	if len(results) != 2 {
+		t.Fatalf("want 2 results, got %d", len(results))
+	}
+	if results[0].RunStatus != Run || !results[0].Command.Target.Equal(util.IntPoint{X: 10000, Y: 0}) {
+		t.Errorf("want AGV 1 run to (10000, 0), result %v", results[0])
+	}
+	if results[1].RunStatus != Idle {
+		t.Errorf("want AGV 2 idle, result %v", results[1])
+	}
+
+	results = c.Update([]AGVStatus{{ID: 1, MotionStatus: MSStop, Pos: util.IntPoint{X: 10000, Y: 0}}})
+	if results[0].RunStatus != Idle {
+		t.Errorf("want AGV 1 arrived, result %v", results[0])
+	}
+}
+
+func TestController_UpdateCommands(t *testing.T) {
+	c := NewController()
+	c.Register(1)
+
+	ends := []util.IntPoint{{X: 5000, Y: 0}, {X: 10000, Y: 0}, {X: 15000, Y: 0}}
+	routes := make([]route.SubRoute, 0, len(ends))
+	start := util.IntPoint{X: 0, Y: 0}
+	for i, end := range ends {
+		routes = append(routes, route.SubRoute{Type: route.Straight, Start: start, End: end, MaxSpeed: 1000,
+			IsContinuousLockWithNext: i < len(ends)-1, IsEndStop: i == len(ends)-1})
+		start = end
+	}
+	c.SetRoutes(1, routes)
+
+	res := c.Update([]AGVStatus{{ID: 1, MotionStatus: MSStop, Pos: util.IntPoint{X: 0, Y: 0}}})[0]
+	if len(res.Commands) != len(ends) {
+		t.Fatalf("want a command per claimed sub route, result %v", res.Commands)
+	}
+	for i, cmd := range res.Commands {
+		if !cmd.Target.Equal(ends[i]) || cmd.IsNeedAccurateStop != (i == len(ends)-1) {
+			t.Errorf("want command %d to (%d, %d), result %v", i, ends[i].X, ends[i].Y, cmd)
+		}
+	}
+	if res.Command != res.Commands[len(ends)-1] {
+		t.Errorf("want last command %v, result %v", res.Commands[len(ends)-1], res.Command)
+	}
+
+	v, _ := c.AGV(1)
+	res = c.Update([]AGVStatus{{ID: 1, MotionStatus: MSStraight, Pos: util.IntPoint{X: 100, Y: 0}, ControlCode: res.Command.Seq}})[0]
+	if len(res.Commands) != 0 || len(v.Pending()) != 0 {
+		t.Errorf("want all commands acked and none sent, result %v %v", res.Commands, v.Pending())
+	}
+}
+
+func TestController_UpdateTurnSpeed(t *testing.T) {
+	c := NewController()
+	c.Register(1)
+	c.SetRoutes(1, []route.SubRoute{
+		{Type: route.Straight, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 20000, Y: 0}, MaxSpeed: 1500,
+			IsContinuousLockWithNext: true},
+		{Type: route.UTurn, Start: util.IntPoint{X: 20000, Y: 0}, End: util.IntPoint{X: 20000, Y: 2000}, MaxSpeed: 1500,
+			RefPoints: [2]util.IntPoint{{X: 21000, Y: 0}, {X: 21000, Y: 2000}}, IsEndStop: true},
+	})
+
+	cmds := c.Update([]AGVStatus{{ID: 1, MotionStatus: MSStop, Pos: util.IntPoint{X: 0, Y: 0}}})[0].Commands
+	if len(cmds) != 2 {
+		t.Fatalf("want straight and UTurn commands, result %v", cmds)
+	}
+	// sqrt(500 * 1000) on a UTurn of radius 1000
+	if cmds[1].MaxSpecialSpeed != 707 || cmds[0].MaxStraightSpeed <= 707 {
+		t.Errorf("want only the UTurn held to 707, result %v", cmds)
+	}
+}
+
+func TestController_UpdateBlocked(t *testing.T) {
+	c := NewController()
+	c.Register(1)
+	c.Register(2)
+	c.Update([]AGVStatus{
+		{ID: 1, MotionStatus: MSStop, Pos: util.IntPoint{X: 0, Y: 0}},
+		{ID: 2, MotionStatus: MSStop, Pos: util.IntPoint{X: 5000, Y: 0}},
+	})
+
+	c.SetRoutes(1, straightRoutes(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 10000, Y: 0}))
+	c.Update(nil)
+
+	v, _ := c.AGV(1)
+	if v.Claim.Index != 0 || v.TryFailedCount != 1 {
+		t.Errorf("want AGV 1 blocked, claim %v, failed %d", v.Claim, v.TryFailedCount)
+	}
+}
+
+func TestController_UpdateForbidden(t *testing.T) {
+	forbidden.Add(1, forbidden.NoInNoOut, 0, util.IntPoint{X: 4000, Y: -500}, util.IntPoint{X: 6000, Y: 500})
+	defer forbidden.Delete(1)
+
+	c := NewController()
+	c.Register(1)
+	c.Update([]AGVStatus{{ID: 1, MotionStatus: MSStop, Pos: util.IntPoint{X: 0, Y: 0}}})
+	c.SetRoutes(1, straightRoutes(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 10000, Y: 0}))
+	c.Update(nil)
+
+	v, _ := c.AGV(1)
+	if v.Claim.Index != 0 || v.TryFailedCount != 1 {
+		t.Errorf("want AGV 1 blocked by forbidden area, claim %v, failed %d", v.Claim, v.TryFailedCount)
+	}
+}
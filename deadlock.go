@@ -0,0 +1,121 @@
+package traffic
+
+import (
+	"encoding/json"
+	"log"
+	"traffic/legume"
+)
+
+type WaitFor struct {
+	ID, BlockerID               int
+	BeanIndex, BlockerBeanIndex int
+	Bean, BlockerBean           legume.OBB
+}
+
+type Deadlock struct {
+	IDs   []int
+	Edges []WaitFor
+}
+
+func (d Deadlock) String() string {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+type waitForGraph map[int][]WaitFor
+
+func (g waitForGraph) add(w WaitFor) {
+	g[w.ID] = append(g[w.ID], w)
+}
+
+// deadlocks finds strongly connected components with Tarjan's algorithm,
+// every component with more than one AGV is a cycle of blocked claims.
+func (g waitForGraph) deadlocks(order []int) (ds []Deadlock) {
+	index := make(map[int]int)
+	low := make(map[int]int)
+	onStack := make(map[int]bool)
+	var stack []int
+	next := 0
+
+	var strongConnect func(id int)
+	strongConnect = func(id int) {
+		index[id] = next
+		low[id] = next
+		next++
+		stack = append(stack, id)
+		onStack[id] = true
+
+		for _, w := range g[id] {
+			if _, ok := index[w.BlockerID]; !ok {
+				strongConnect(w.BlockerID)
+				if low[w.BlockerID] < low[id] {
+					low[id] = low[w.BlockerID]
+				}
+			} else if onStack[w.BlockerID] && index[w.BlockerID] < low[id] {
+				low[id] = index[w.BlockerID]
+			}
+		}
+
+		if low[id] != index[id] {
+			return
+		}
+
+		var ids []int
+		in := make(map[int]bool)
+		for {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[n] = false
+			ids = append(ids, n)
+			in[n] = true
+			if n == id {
+				break
+			}
+		}
+
+		if len(ids) < 2 {
+			return
+		}
+
+		d := Deadlock{IDs: ids}
+		for _, n := range ids {
+			for _, w := range g[n] {
+				if in[w.BlockerID] {
+					d.Edges = append(d.Edges, w)
+				}
+			}
+		}
+		ds = append(ds, d)
+	}
+
+	for _, id := range order {
+		if _, ok := index[id]; !ok {
+			strongConnect(id)
+		}
+	}
+
+	return ds
+}
+
+func (c *Controller) Deadlocks() []Deadlock {
+	return c.deadlocks
+}
+
+func (c *Controller) detectDeadlock() {
+	for _, v := range c.agvs {
+		if v.ErrorCode == ECDeadlock {
+			v.ErrorCode = ECNone
+		}
+	}
+
+	c.deadlocks = c.waitFor.deadlocks(c.order)
+	for _, d := range c.deadlocks {
+		log.Printf("<Controller.detectDeadlock> deadlock AGV %v, %s\n", d.IDs, d)
+		for _, id := range d.IDs {
+			c.agvs[id].ErrorCode = ECDeadlock
+		}
+	}
+}
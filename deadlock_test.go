@@ -0,0 +1,43 @@
+package traffic
+
+import (
+	"testing"
+	"traffic/util"
+)
+
+func TestWaitForGraph_Deadlocks(t *testing.T) {
+	g := make(waitForGraph)
+	g.add(WaitFor{ID: 1, BlockerID: 2})
+	g.add(WaitFor{ID: 2, BlockerID: 3})
+	g.add(WaitFor{ID: 3, BlockerID: 1})
+	g.add(WaitFor{ID: 4, BlockerID: 1})
+
+	ds := g.deadlocks([]int{1, 2, 3, 4})
+	if len(ds) != 1 || len(ds[0].IDs) != 3 || len(ds[0].Edges) != 3 {
+		t.Errorf("want one deadlock of AGV 1 2 3, result %v", ds)
+	}
+}
+
+func TestController_DetectDeadlock(t *testing.T) {
+	c := NewController()
+	c.Register(1)
+	c.Register(2)
+	c.Update([]AGVStatus{
+		{ID: 1, MotionStatus: MSStop, Pos: util.IntPoint{X: 0, Y: 0}},
+		{ID: 2, MotionStatus: MSStop, Heading: 180, Pos: util.IntPoint{X: 10000, Y: 0}},
+	})
+
+	c.SetRoutes(1, straightRoutes(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 10000, Y: 0}))
+	c.SetRoutes(2, straightRoutes(util.IntPoint{X: 10000, Y: 0}, util.IntPoint{X: 0, Y: 0}))
+	results := c.Update(nil)
+
+	ds := c.Deadlocks()
+	if len(ds) != 1 || len(ds[0].IDs) != 2 {
+		t.Fatalf("want deadlock of AGV 1 2, result %v", ds)
+	}
+	for _, r := range results {
+		if r.ErrorCode != ECDeadlock {
+			t.Errorf("want AGV %d error code deadlock, result %v", r.ID, r)
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package forbidden
 
 import (
+	"container/ring"
 	"log"
-	"traffic"
-	"traffic/route"
+	"traffic/legume"
+	"traffic/util"
 )
 
 const (
@@ -14,20 +15,20 @@ const (
 
 type ForbiddenArea struct {
 	ID, Type, RelateID int
-	Min, Max           route.IntPoint
-	o                  traffic.OBB
+	Min, Max           util.IntPoint
+	o                  legume.OBB
 }
 
-var gFobiddenAreas map[int]ForbiddenArea
+var gFobiddenAreas = make(map[int]ForbiddenArea)
 var gIsForbiddenAreaModified = false
 
-func create(id, t, rid int, min, max route.IntPoint) ForbiddenArea {
-	o := traffic.CreateOBB(route.FloatPoint{X: 0.5 * float64(min.X+max.X), Y: 0.5 * float64(min.Y+max.Y)},
+func create(id, t, rid int, min, max util.IntPoint) ForbiddenArea {
+	o := legume.CreateOBB(util.FloatPoint{X: 0.5 * float64(min.X+max.X), Y: 0.5 * float64(min.Y+max.Y)},
 		0.5*float64(max.X-min.X), 0.5*float64(max.Y-min.Y), 0)
 	return ForbiddenArea{id, t, rid, min, max, o}
 }
 
-func Add(id, t, rid int, min, max route.IntPoint) bool {
+func Add(id, t, rid int, min, max util.IntPoint) bool {
 	log.Printf("<forbidden.Add> id %d, type %d, AGV id %d,  min(%d, %d) max(%d, %d)\n",
 		id, t, rid, min.X, min.Y, max.X, max.Y)
 	defer log.Println("<forbidden.Add> exit")
@@ -46,16 +47,17 @@ func Delete(id int) bool {
 	log.Printf("<forbidden.Delete> id %d\n", id)
 	defer log.Println("<forbidden.Delete> exit")
 
-	if _, ok := gFobiddenAreas[id]; ok {
+	if _, ok := gFobiddenAreas[id]; !ok {
 		log.Printf("can't find Forbidden Area %d \n", id)
 		return false
 	}
 
 	delete(gFobiddenAreas, id)
 	gIsForbiddenAreaModified = true
+	return true
 }
 
-func Modify(id, t, rid int, min, max route.IntPoint) bool {
+func Modify(id, t, rid int, min, max util.IntPoint) bool {
 	log.Printf("<forbidden.Modify> id %d, type %d, AGV id %d,  min(%d, %d) max(%d, %d)\n",
 		id, t, rid, min.X, min.Y, max.X, max.Y)
 	defer log.Println("<forbidden.Modify> exit")
@@ -75,5 +77,25 @@ func IsAnyModified() bool {
 }
 
 func ResetModifiedFlag() {
-	gIsForbiddenAreaModified = true
+	gIsForbiddenAreaModified = false
+}
+
+func (fa ForbiddenArea) isBlock(agvID int, body legume.OBB) bool {
+	switch fa.Type {
+	case IgnoreRelateAGV:
+		return fa.RelateID != agvID
+	case NoInOnlyOut:
+		return !fa.o.IsOverlap(body)
+	default:
+		return true
+	}
+}
+
+func IsOverlapWithLegume(agvID int, body legume.OBB, l *legume.Legume, start, end *ring.Ring) (bool, int) {
+	for id, fa := range gFobiddenAreas {
+		if fa.isBlock(agvID, body) && l.IsOverlapWithOBB(start, end, fa.o) {
+			return true, id
+		}
+	}
+	return false, 0
 }
@@ -0,0 +1,227 @@
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"traffic/route"
+	"traffic/util"
+)
+
+const gLayoutVersion = 1
+
+var gMoveTypeNames = map[string]int{
+	"Straight": route.Straight,
+	"QTurn":    route.QTurn,
+	"Oblique":  route.Oblique,
+	"UTurn":    route.UTurn,
+	"STurn":    route.STurn,
+	"Linkage":  route.Linkage,
+}
+
+type Node struct {
+	ID     int
+	Pos    util.IntPoint
+	IsStop bool
+}
+
+type Move struct {
+	Type      string
+	Name      string
+	MoveType  int
+	RefParams [6]int32
+	RefPoints [2]util.IntPoint
+}
+
+func (m Move) RouteType() int {
+	t, ok := gMoveTypeNames[m.Type]
+	if !ok {
+		return route.Invalid
+	}
+	return t
+}
+
+type Edge struct {
+	From, To                                   int
+	Moves                                      []Move
+	MaxSpeed, MaxAcceleration, MaxDeceleration int
+	IsStop, IsAstern                           bool
+}
+
+type Layout struct {
+	Version int
+	Name    string
+	Nodes   []Node
+	Edges   []Edge
+
+	nodes map[int]int
+	out   map[int][]int
+}
+
+func (l Layout) String() string {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func (l *Layout) LoadFromJSONFile(fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(data, l); err != nil {
+		return err
+	}
+
+	return l.Validate()
+}
+
+func (l *Layout) Validate() error {
+	if l.Version != gLayoutVersion {
+		return fmt.Errorf("Layout %s: unsupported version %d, want %d", l.Name, l.Version, gLayoutVersion)
+	}
+
+	l.nodes = make(map[int]int)
+	for i, n := range l.Nodes {
+		if _, ok := l.nodes[n.ID]; ok {
+			return fmt.Errorf("Layout %s: duplicate node %d", l.Name, n.ID)
+		}
+		l.nodes[n.ID] = i
+	}
+
+	l.out = make(map[int][]int)
+	for i, e := range l.Edges {
+		if err := l.validateEdge(e); err != nil {
+			return fmt.Errorf("Layout %s: edge %d (%d -> %d): %s", l.Name, i, e.From, e.To, err)
+		}
+
+		for _, j := range l.out[e.From] {
+			if l.Edges[j].To == e.To {
+				return fmt.Errorf("Layout %s: duplicate edge %d -> %d", l.Name, e.From, e.To)
+			}
+		}
+		l.out[e.From] = append(l.out[e.From], i)
+	}
+
+	return nil
+}
+
+func isAxisAligned(a, b util.IntPoint) bool {
+	return !a.Equal(b) && (a.X == b.X || a.Y == b.Y)
+}
+
+func (l *Layout) validateEdge(e Edge) error {
+	from, ok := l.Node(e.From)
+	if !ok {
+		return fmt.Errorf("unknown from node")
+	}
+	to, ok := l.Node(e.To)
+	if !ok {
+		return fmt.Errorf("unknown to node")
+	}
+	if e.From == e.To {
+		return fmt.Errorf("from and to are the same node")
+	}
+	if e.MaxSpeed < 0 || e.MaxAcceleration < 0 || e.MaxDeceleration < 0 {
+		return fmt.Errorf("negative speed limit")
+	}
+	if len(e.Moves) == 0 {
+		return fmt.Errorf("no move allowed")
+	}
+
+	for _, m := range e.Moves {
+		if err := validateMove(m, from.Pos, to.Pos); err != nil {
+			return fmt.Errorf("move %s %s: %s", m.Type, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func validateMove(m Move, start, end util.IntPoint) error {
+	switch m.RouteType() {
+	case route.Straight:
+		if !isAxisAligned(start, end) {
+			return fmt.Errorf("straight is not axis aligned")
+		}
+
+	case route.Linkage:
+		if !isAxisAligned(start, end) {
+			return fmt.Errorf("linkage is not axis aligned")
+		}
+
+	case route.QTurn:
+		corner := m.RefPoints[0]
+		if m.MoveType <= 0 {
+			return fmt.Errorf("missing move type id")
+		}
+		if !isAxisAligned(start, corner) || !isAxisAligned(corner, end) {
+			return fmt.Errorf("corner (%d, %d) is not axis aligned", corner.X, corner.Y)
+		}
+		if (start.X == corner.X) == (corner.X == end.X) {
+			return fmt.Errorf("corner (%d, %d) is not a quarter turn", corner.X, corner.Y)
+		}
+
+	case route.Oblique:
+		dx, dy := abs(end.X-start.X), abs(end.Y-start.Y)
+		if dx == 0 || dy == 0 {
+			return fmt.Errorf("oblique is axis aligned")
+		}
+		if int(m.RefParams[0]) != dx && int(m.RefParams[0]) != dy {
+			return fmt.Errorf("lateral offset %d not match", m.RefParams[0])
+		}
+
+	case route.UTurn, route.STurn:
+		p0, p1 := m.RefPoints[0], m.RefPoints[1]
+		if !isAxisAligned(start, p0) || !isAxisAligned(p1, end) {
+			return fmt.Errorf("reference points are not axis aligned")
+		}
+
+	default:
+		return fmt.Errorf("unknown move type")
+	}
+
+	return nil
+}
+
+func abs(x int) int {
+	if x >= 0 {
+		return x
+	}
+	return -x
+}
+
+func (l *Layout) Node(id int) (Node, bool) {
+	i, ok := l.nodes[id]
+	if !ok {
+		return Node{}, false
+	}
+	return l.Nodes[i], true
+}
+
+func (l *Layout) OutEdges(id int) []Edge {
+	edges := make([]Edge, 0, len(l.out[id]))
+	for _, i := range l.out[id] {
+		edges = append(edges, l.Edges[i])
+	}
+	return edges
+}
+
+func (l *Layout) NodeAt(p util.IntPoint) (Node, bool) {
+	for _, n := range l.Nodes {
+		if n.Pos.Equal(p) {
+			return n, true
+		}
+	}
+	return Node{}, false
+}
@@ -0,0 +1,53 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+	"traffic/route"
+	"traffic/util"
+)
+
+func TestLayout_LoadFromJSONFile(t *testing.T) {
+	var l Layout
+	if err := l.LoadFromJSONFile("data/example.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, ok := l.Node(4)
+	if !ok || !n.Pos.Equal(util.IntPoint{X: 11300, Y: 1400}) {
+		t.Errorf("want node 4 at (11300, 1400), result %v %v", ok, n)
+	}
+
+	edges := l.OutEdges(2)
+	if len(edges) != 3 {
+		t.Errorf("want 3 edges from node 2, result %d", len(edges))
+	}
+
+	edges = l.OutEdges(3)
+	if len(edges) != 2 || edges[1].Moves[0].RouteType() != route.QTurn {
+		t.Errorf("want QTurn from node 3, result %v", edges)
+	}
+}
+
+func TestLayout_Validate(t *testing.T) {
+	nodes := []Node{{ID: 1, Pos: util.IntPoint{X: 0, Y: 0}}, {ID: 2, Pos: util.IntPoint{X: 5000, Y: 1000}}}
+	cases := []struct {
+		Layout
+		err string
+	}{
+		{Layout{Version: 2}, "unsupported version"},
+		{Layout{Version: 1, Nodes: []Node{{ID: 1}, {ID: 1}}}, "duplicate node"},
+		{Layout{Version: 1, Nodes: nodes, Edges: []Edge{{From: 1, To: 3, Moves: []Move{{Type: "Straight"}}}}}, "unknown to node"},
+		{Layout{Version: 1, Nodes: nodes, Edges: []Edge{{From: 1, To: 2, Moves: []Move{{Type: "Straight"}}}}}, "not axis aligned"},
+		{Layout{Version: 1, Nodes: nodes, Edges: []Edge{{From: 1, To: 2, Moves: []Move{{Type: "Fly"}}}}}, "unknown move type"},
+		{Layout{Version: 1, Nodes: nodes, Edges: []Edge{{From: 1, To: 2}}}, "no move allowed"},
+		{Layout{Version: 1, Nodes: nodes, Edges: []Edge{{From: 1, To: 2, Moves: []Move{{Type: "Oblique", RefParams: [6]int32{700}}}}}}, "lateral offset"},
+	}
+
+	for _, c := range cases {
+		err := c.Validate()
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("want error %q, result %v", c.err, err)
+		}
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"container/ring"
 	"fmt"
 	"log"
+	"math"
+	"traffic/route"
 	"traffic/track"
 	"traffic/util"
+	"traffic/vehicle"
 )
 
 const gLEGUME_RINGBUFFER_SIZE = 5000
@@ -21,9 +24,25 @@ type Legume struct {
 	n                     int
 	ringBuf               *ring.Ring
 	self, claimed, trying *ring.Ring
+	model                 *vehicle.Model
 }
 
+func (l *Legume) SetModel(m *vehicle.Model) {
+	l.model = m
+}
+
+func (l *Legume) Model() *vehicle.Model {
+	if l.model == nil {
+		return &vehicle.Default
+	}
+	return l.model
+}
+
+// Init allocates a ring of n beans, AppendBean grows it when full.
 func (l *Legume) Init(n int) {
+	if n < 2 {
+		n = 2
+	}
 	l.ringBuf = ring.New(n)
 	l.self = l.ringBuf
 	l.claimed = l.ringBuf
@@ -35,6 +54,41 @@ func (l *Legume) Reset() {
 	l.trying = l.claimed
 }
 
+func (l *Legume) Clear() {
+	l.self = l.ringBuf
+	l.claimed = l.ringBuf
+	l.trying = l.ringBuf
+}
+
+func (l *Legume) Claimed() (start, end *ring.Ring) {
+	return l.self, l.claimed
+}
+
+func (l *Legume) Trying() (start, end *ring.Ring) {
+	return l.claimed, l.trying
+}
+
+func (l *Legume) Body() OBB {
+	b, _ := l.self.Value.(bean)
+	return b.OBB
+}
+
+func BeanIndex(r *ring.Ring) int {
+	return r.Value.(bean).index
+}
+
+func BeanOBB(r *ring.Ring) OBB {
+	return r.Value.(bean).OBB
+}
+
+func (l *Legume) ClaimTrying() {
+	l.claimed = l.trying
+}
+
+func (l *Legume) ResetTrying() {
+	l.trying = l.claimed
+}
+
 func (l *Legume) String() string {
 	var buf bytes.Buffer
 	for r := l.self; r != l.trying; r = r.Next() {
@@ -44,10 +98,23 @@ func (l *Legume) String() string {
 	return buf.String()
 }
 
+// grow doubles the ring once the next bean would wrap onto self, where
+// self == trying reads as empty. The new slots go right after trying so the
+// beans keep their order.
+func (l *Legume) grow() {
+	if l.trying.Next() != l.self {
+		return
+	}
+	n := l.ringBuf.Len()
+	log.Printf("<Legume.grow> ring full, grow from %d to %d\n", n, 2*n)
+	l.trying.Link(ring.New(n))
+}
+
 func (l *Legume) AppendBean(o OBB) {
 	b := bean{OBB: o}
 
 	if l.self == l.trying {
+		l.grow()
 		b.index = 0
 		l.trying.Value = b
 		l.trying = l.trying.Next()
@@ -55,8 +122,9 @@ func (l *Legume) AppendBean(o OBB) {
 	}
 
 	tail := l.trying.Prev().Value.(bean)
-	if l.self == l.trying || !tail.Center.Equal(b.Center) || !tail.deg.Equal(b.deg) ||
+	if !tail.Center.Equal(b.Center) || !tail.deg.Equal(b.deg) ||
 		tail.XHalfLength != b.XHalfLength || tail.YHalfLength != b.YHalfLength {
+		l.grow()
 		b.index = tail.index + 1
 		b.isStop = false
 		l.trying.Value = b
@@ -92,83 +160,149 @@ func (l *Legume) IsOverlapWithLegume(start, end *ring.Ring, q *Legume, qStart, q
 	return false, nil, nil
 }
 
+func (l *Legume) GrowSlice(start, end util.FloatPoint, xh, yh float64, deg util.Degree) {
+	distance := start.Distance(end)
+	n := int(math.Ceil(distance / gFactorLinearDX))
+	if n == 0 {
+		l.GrowCenter(start, xh, yh, deg)
+		return
+	}
+
+	for i := 0; i <= n; i++ {
+		k := float64(i) / float64(n)
+		c := util.FloatPoint{X: start.X + k*(end.X-start.X), Y: start.Y + k*(end.Y-start.Y)}
+		l.GrowCenter(c, xh, yh, deg)
+	}
+}
+
 func (l *Legume) GrowStraightSlice(start, end util.IntPoint) {
 	if start.Equal(end) {
 		return
 	}
 
-	f := track.Function{Start: start.ToFloatPoint(), End: end.ToFloatPoint()}
-	if start.X == end.X {
-		f.P[3] = 1
-		f.P[5] = start.ToFloatPoint().X
-	} else {
-		f.P[3] = float64(end.Y-start.Y) / float64(end.X-start.X)
-		f.P[4] = -1
-		f.P[5] = start.ToFloatPoint().Y - f.P[3]*start.ToFloatPoint().X
-	}
+	m := l.Model()
+	l.GrowSlice(start.ToFloatPoint(), end.ToFloatPoint(), m.HalfLength, m.HalfWidth,
+		end.ToFloatPoint().DegreeTo(start.ToFloatPoint()))
 }
 
-const (
-	gFactorLinearDX    = 100
-	gFactorQuadraticDX = 10
-	gAGVWheelbase      = 1200
-)
+func (l *Legume) GrowJointSlice(start, end, offset util.IntPoint, deg util.Degree) {
+	o := offset.ToFloatPoint()
+	rad := float64(deg) * math.Pi / 180
+	along := o.X*math.Cos(rad) + o.Y*math.Sin(rad)
+	lateral := -o.X*math.Sin(rad) + o.Y*math.Cos(rad)
 
-func (l *Legume) GrowAlongTrack(t track.Track, xh, yh float64) error {
-	var f, r util.FloatPoint
-	rn := 0
-	for fn := 0; fn < len(t.Front); {
-		log.Printf("fn %d", fn)
-		nextFront, res := t.Front[fn].NextPoint(f, gFactorQuadraticDX)
-		if res == track.NotFount {
-			return fmt.Errorf("Can't find next front %d", fn)
-		}
+	m := l.Model()
+	half := util.FloatPoint{X: o.X / 2, Y: o.Y / 2}
+	l.GrowSlice(start.ToFloatPoint().Shift(half), end.ToFloatPoint().Shift(half),
+		m.HalfLength+math.Abs(along)/2, m.HalfWidth+math.Abs(lateral)/2, deg)
+}
 
-		for rn < len(t.Rear) {
-			nextRear, res := t.Rear[rn].NextPointRef(r, nextFront, gAGVWheelbase)
-			if res == track.NotFount {
-				rn++
-				nextRear = util.FloatPointZero
-				continue
-			}
+func (l *Legume) GrowPolyline(points ...util.IntPoint) {
+	for i := 1; i < len(points); i++ {
+		l.GrowStraightSlice(points[i-1], points[i])
+	}
+}
 
-			isBreak := nextFront.Distance(nextRear) < gAGVWheelbase+10
-			if isBreak {
-				l.GrowFrontRear(nextFront, nextRear, xh, yh)
-			}
+// Apply returns a copy of the claimed and trying beans mapped by s.
+func (l *Legume) Apply(s util.Symmetry) *Legume {
+	q := &Legume{model: l.model}
+	q.Init(l.ringBuf.Len())
+	for r := l.self; r != l.trying; r = r.Next() {
+		q.AppendBean(r.Value.(bean).OBB.Apply(s))
+	}
+	return q
+}
 
-			if res == track.EndPoint {
-				rn++
-				r = util.FloatPointZero
-			} else {
-				r = nextRear
-			}
+func (l *Legume) AppendLegume(q *Legume, shift util.FloatPoint) {
+	for r := q.self; r != q.trying; r = r.Next() {
+		o := r.Value.(bean).OBB
+		l.AppendBean(CreateOBB(o.Center.Shift(shift), o.XHalfLength, o.YHalfLength, o.deg))
+	}
+}
 
-			if isBreak {
-				break
-			}
-		}
+func (l *Legume) GrowSubRoute(sr route.SubRoute) error {
+	in, assist := sr.InOutDirection()
+	if in == util.DirErr {
+		return fmt.Errorf("Can't grow sub route type %d", sr.Type)
+	}
+
+	from := l.trying
+	switch sr.Type {
+	case route.Straight:
+		l.GrowStraightSlice(sr.Start, sr.End)
 
-		if res == track.EndPoint {
-			fn++
-			f = util.FloatPointZero
+	case route.QTurn:
+		if bl := baseLegume(l.Model(), sr.MoveType, in, assist, sr.IsAstern); bl != nil {
+			l.AppendLegume(bl, sr.RefPoints[0].ToFloatPoint())
 		} else {
-			f = nextFront
+			l.GrowPolyline(sr.Start, sr.RefPoints[0], sr.End)
 		}
+
+	case route.Oblique:
+		l.GrowSlice(sr.Start.ToFloatPoint(), sr.End.ToFloatPoint(), l.Model().HalfLength, l.Model().HalfWidth, in.ToDegree())
+
+	case route.UTurn, route.STurn:
+		l.GrowPolyline(sr.Start, sr.RefPoints[0], sr.RefPoints[1], sr.End)
+
+	case route.Linkage:
+		_, offset, _ := sr.LinkagePartner()
+		l.GrowJointSlice(sr.Start, sr.End, offset, in.ToDegree())
+	}
+
+	if sr.IsAstern {
+		l.turnHeading(from)
+	}
+
+	if sr.IsEndStop && l.self != l.trying {
+		tail := l.trying.Prev()
+		b := tail.Value.(bean)
+		b.isStop = true
+		tail.Value = b
 	}
 
 	return nil
 }
 
-var gBaseLegume map[int]*Legume = make(map[int]*Legume)
+const (
+	gFactorLinearDX    = 100
+	gFactorQuadraticDX = 10
+)
+
+// turnHeading points the beans from from on backwards. A box turned about its
+// centre covers the same area, the body of a straight slice is symmetric and
+// the turn beans of an astern QTurn already have their extents swapped.
+func (l *Legume) turnHeading(from *ring.Ring) {
+	for r := from; r != l.trying; r = r.Next() {
+		b := r.Value.(bean)
+		b.OBB = CreateOBB(b.Center, b.XHalfLength, b.YHalfLength, b.deg+180)
+		r.Value = b
+	}
+}
+
+func (l *Legume) GrowAlongTrack(t track.Track, xh, yh float64) error {
+	return t.Walk(gFactorQuadraticDX, l.Model().Wheelbase, func(f, r util.FloatPoint) {
+		l.GrowFrontRear(f, r, xh, yh)
+	})
+}
+
+type baseKey struct {
+	model      string
+	moveTypeID int
+	d1, d2     util.Direction
+	isAstern   bool
+}
+
+var gBaseLegume map[baseKey]*Legume = make(map[baseKey]*Legume)
 
 const (
-	STARIGHT_HALF_HEIGHT = 850
-	STARIGHT_HALF_WEIGHT = 170
+	STARIGHT_HALF_HEIGHT = vehicle.DefaultHalfLength
+	STARIGHT_HALF_WEIGHT = vehicle.DefaultHalfWidth
 )
 
-func stemLegume(moveTypeID int) *Legume {
-	key := moveTypeID*100 + int(util.XInc)*10 + int(util.YInc)
+// stemLegume sweeps the turn from XInc to YInc. Astern the rear of the body
+// leads, so the front and rear extents of the OBB size swap.
+func stemLegume(m *vehicle.Model, moveTypeID int, isAstern bool) *Legume {
+	key := baseKey{m.Name, moveTypeID, util.XInc, util.YInc, isAstern}
 
 	l, ok := gBaseLegume[key]
 	if ok {
@@ -180,41 +314,62 @@ func stemLegume(moveTypeID int) *Legume {
 		return nil
 	}
 
-	l = &Legume{}
+	l = &Legume{model: m}
 	l.Init(500)
-	l.GrowFrontRear(t.Front[0].Start, t.Rear[0].Start, STARIGHT_HALF_HEIGHT, STARIGHT_HALF_WEIGHT)
+	l.GrowFrontRear(t.Front[0].Start, t.Rear[0].Start, m.HalfLength, m.HalfWidth)
 
 	if l.GrowAlongTrack(t, 0, 0) != nil {
 		return nil
 	}
 
-	os, err := track.GetOBBSize(moveTypeID)
+	size, err := obbSize(m, moveTypeID)
 	if err != nil {
+		log.Printf("<stemLegume> model %s: %s\n", m.Name, err)
 		return nil
 	}
+	if isAstern {
+		size.Front, size.Rear = size.Rear, size.Front
+	}
 
 	for i := l.self; i != l.trying; i = i.Next() {
 		b := i.Value.(bean)
-		b.Center = b.OBB.Centroid(os.Front, os.Rear, os.Inner, os.Outer)
-		b.XHalfLength = 0.5 * (os.Front + os.Rear)
-		b.YHalfLength = 0.5 * (os.Inner + os.Outer)
+		b.Center = b.OBB.Centroid(size.Front, size.Rear, size.Inner, size.Outer)
+		b.XHalfLength = 0.5 * (size.Front + size.Rear)
+		b.YHalfLength = 0.5 * (size.Inner + size.Outer)
+		i.Value = b
 	}
 
-	l.GrowFrontRear(t.Front[len(t.Front)-1].End, t.Rear[len(t.Rear)-1].End, STARIGHT_HALF_HEIGHT, STARIGHT_HALF_WEIGHT)
+	l.GrowFrontRear(t.Front[len(t.Front)-1].End, t.Rear[len(t.Rear)-1].End, m.HalfLength, m.HalfWidth)
 
 	gBaseLegume[key] = l
 	return gBaseLegume[key]
 }
 
+func obbSize(m *vehicle.Model, moveTypeID int) (vehicle.OBBSize, error) {
+	if size, ok := m.OBBSize(moveTypeID); ok {
+		return size, nil
+	}
+
+	s, err := track.GetOBBSize(moveTypeID)
+	if err != nil {
+		return vehicle.OBBSize{}, err
+	}
+	return vehicle.OBBSize{Front: s.Front, Rear: s.Rear, Inner: s.Inner, Outer: s.Outer}, nil
+}
+
 func BaseLegume(moveTypeID int, d1, d2 util.Direction) *Legume {
-	key := moveTypeID*100 + int(d1)*10 + int(d2)
+	return baseLegume(&vehicle.Default, moveTypeID, d1, d2, false)
+}
+
+func baseLegume(m *vehicle.Model, moveTypeID int, d1, d2 util.Direction, isAstern bool) *Legume {
+	key := baseKey{m.Name, moveTypeID, d1, d2, isAstern}
 
 	l, ok := gBaseLegume[key]
 	if ok {
 		return l
 	}
 
-	sl := stemLegume(moveTypeID)
+	sl := stemLegume(m, moveTypeID, isAstern)
 	if sl == nil {
 		return nil
 	}
@@ -222,13 +377,11 @@ func BaseLegume(moveTypeID int, d1, d2 util.Direction) *Legume {
 	if d1 == util.XInc && d2 == util.YInc {
 		return sl
 	}
-
-	l.Init(500)
-
-	for i := l.self; i != l.trying; i = i.Next() {
-		l.AppendBean(i.Value.(bean).Transform(d1, d2))
+	if d2 == d1 || d2 == d1.Opposite() {
+		log.Printf("<baseLegume> move type %d: %s to %s isn't a turn\n", moveTypeID, d1, d2)
+		return nil
 	}
 
-	gBaseLegume[key] = l
+	gBaseLegume[key] = sl.Apply(util.NewSymmetry(d1, d2))
 	return gBaseLegume[key]
 }
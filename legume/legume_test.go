@@ -3,10 +3,179 @@ package legume
 import (
 	"log"
 	"testing"
+	"traffic/route"
 	"traffic/util"
+	"traffic/vehicle"
 )
 
 func TestBaseLegume(t *testing.T) {
-	l := baseLegume(10, util.XInc, util.YInc)
+	l := BaseLegume(10, util.XInc, util.YInc)
 	log.Print(l)
 }
+
+func TestBaseLegume_OBBSize(t *testing.T) {
+	l := BaseLegume(10, util.XInc, util.YInc)
+	if l == nil {
+		t.Fatal("want base legume of move type 10")
+	}
+
+	b := l.self.Next().Value.(bean)
+	if b.XHalfLength != 900 || b.YHalfLength != 230 {
+		t.Errorf("want bean sized by OBB size catalog, result %v", b.OBB)
+	}
+	if BaseLegume(-1, util.XInc, util.YInc) != nil {
+		t.Error("want no base legume for unknown move type")
+	}
+}
+
+func TestLegume_IsOverlapWithLegume(t *testing.T) {
+	l := &Legume{}
+	l.Init(100)
+	l.GrowStraightSlice(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 3000, Y: 0})
+	l.Reset()
+	l.GrowStraightSlice(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 3000, Y: 0})
+	l.ClaimTrying()
+
+	q := &Legume{}
+	q.Init(100)
+	q.GrowStraightSlice(util.IntPoint{X: 1500, Y: -3000}, util.IntPoint{X: 1500, Y: 3000})
+
+	start, end := l.Claimed()
+	qStart, qEnd := q.Trying()
+	if res, _, _ := l.IsOverlapWithLegume(start, end, q, qStart, qEnd); !res {
+		t.Error("want overlap with crossing legume")
+	}
+
+	q.Clear()
+	q.GrowStraightSlice(util.IntPoint{X: 5000, Y: -3000}, util.IntPoint{X: 5000, Y: 3000})
+	qStart, qEnd = q.Trying()
+	if res, _, _ := l.IsOverlapWithLegume(start, end, q, qStart, qEnd); res {
+		t.Error("want no overlap with distant legume")
+	}
+}
+
+func TestLegume_AppendBeanGrow(t *testing.T) {
+	l := &Legume{}
+	l.Init(4)
+	l.GrowStraightSlice(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 3000, Y: 0})
+
+	n := 0
+	for r := l.self; r != l.trying; r = r.Next() {
+		if BeanIndex(r) != n {
+			t.Fatalf("want bean %d in order, result %d", n, BeanIndex(r))
+		}
+		n++
+	}
+	if n != 31 {
+		t.Errorf("want 31 beans kept past the initial ring, result %d", n)
+	}
+}
+
+func TestLegume_GrowJointSlice(t *testing.T) {
+	l := &Legume{}
+	l.Init(100)
+	l.GrowJointSlice(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 1000, Y: 0}, util.IntPoint{X: 3000, Y: 0}, 0)
+
+	start, end := l.Trying()
+	o := BeanOBB(start)
+	if !o.Center.Equal(util.FloatPoint{X: 1500, Y: 0}) || o.XHalfLength != STARIGHT_HALF_HEIGHT+1500 {
+		t.Errorf("want joint bean cover both AGV, result %s", o)
+	}
+
+	partner := CreateOBB(util.FloatPoint{X: 3500, Y: 0}, STARIGHT_HALF_HEIGHT, STARIGHT_HALF_WEIGHT, 0)
+	if !l.IsOverlapWithOBB(start, end, partner) {
+		t.Error("want joint legume overlap with partner")
+	}
+}
+
+func TestLegume_GrowSubRouteAstern(t *testing.T) {
+	l := &Legume{}
+	l.Init(100)
+	sr := route.SubRoute{Type: route.Straight, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 1000, Y: 0}, IsAstern: true}
+	if err := l.GrowSubRoute(sr); err != nil {
+		t.Fatal(err)
+	}
+
+	q := &Legume{}
+	q.Init(100)
+	sr.IsAstern = false
+	q.GrowSubRoute(sr)
+
+	qs, _ := q.Trying()
+	start, end := l.Trying()
+	for r := start; r != end; r, qs = r.Next(), qs.Next() {
+		if !BeanOBB(r).Center.Equal(BeanOBB(qs).Center) || !BeanOBB(r).deg.Equal(BeanOBB(qs).deg+180) {
+			t.Fatalf("want astern bean flipped, result %s and %s", BeanOBB(r), BeanOBB(qs))
+		}
+	}
+
+	m := vehicle.Default
+	m.Name = "astern"
+	m.OBBSizes = map[int]vehicle.OBBSize{10: {Front: 1200, Rear: 600, Inner: 200, Outer: 260}}
+	turn := route.SubRoute{Type: route.QTurn, MoveType: 10, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 1300, Y: 1400},
+		RefPoints: [2]util.IntPoint{{X: 1300, Y: 0}, {}}}
+	forward, astern := &Legume{model: &m}, &Legume{model: &m}
+	forward.Init(100)
+	astern.Init(100)
+	forward.GrowSubRoute(turn)
+	turn.IsAstern = true
+	if err := astern.GrowSubRoute(turn); err != nil {
+		t.Fatal(err)
+	}
+
+	qs, _ = forward.Trying()
+	start, end = astern.Trying()
+	moved := 0
+	for r := start; r != end; r, qs = r.Next(), qs.Next() {
+		if d := BeanOBB(r).Center.Distance(BeanOBB(qs).Center); util.FloatEqualTolerance(d, 600, 0.01) {
+			moved++
+		} else if d > 0.01 {
+			t.Fatalf("want astern bean shifted by front minus rear, result %s and %s", BeanOBB(r), BeanOBB(qs))
+		}
+	}
+	if moved == 0 {
+		t.Error("want astern QTurn footprint differ from forward")
+	}
+}
+
+func isSameOBB(o, q OBB) bool {
+	return o.Center.Equal(q.Center) && o.deg.Normalize().Equal(q.deg.Normalize()) &&
+		o.XHalfLength == q.XHalfLength && o.YHalfLength == q.YHalfLength
+}
+
+func TestBaseLegume_Transform(t *testing.T) {
+	base := BaseLegume(10, util.XInc, util.YInc)
+	if base == nil {
+		t.Fatal("want base legume of move type 10")
+	}
+
+	for _, d1 := range []util.Direction{util.XInc, util.XDec, util.YInc, util.YDec} {
+		for _, d2 := range []util.Direction{util.XInc, util.XDec, util.YInc, util.YDec} {
+			l := BaseLegume(10, d1, d2)
+			if d2 == d1 || d2 == d1.Opposite() {
+				if l != nil {
+					t.Errorf("want no legume from %s to %s", d1, d2)
+				}
+				continue
+			}
+
+			// beans only apart by a full turn of heading merge once mapped
+			s := util.NewSymmetry(d1, d2)
+			r := l.self
+			for b := base.self; b != base.trying; b = b.Next() {
+				o := BeanOBB(b).Apply(s)
+				if r != l.trying && isSameOBB(o, BeanOBB(r)) {
+					r = r.Next()
+				} else if r == l.self || !isSameOBB(o, BeanOBB(r.Prev())) {
+					t.Fatalf("%s to %s: want %s mapped, result %s", d1, d2, o, BeanOBB(r))
+				}
+			}
+		}
+	}
+
+	l := BaseLegume(10, util.XDec, util.YInc)
+	end := BeanOBB(l.trying.Prev())
+	if end.Center.X > 0 || end.Center.Y < 0 || !end.deg.Equal(90) {
+		t.Errorf("want turn from XDec ending towards YInc, result %s %v", end, end.deg)
+	}
+}
@@ -53,7 +53,7 @@ func CreateOBB(c util.FloatPoint, xh, yh float64, deg util.Degree) (o OBB) {
 	o.XHalfLength = xh
 	o.YHalfLength = yh
 	o.deg = deg
-	o.xAxis = Vector{math.Cos(float64(deg)), math.Sin(float64(deg))}
+	o.xAxis = Vector{math.Cos(float64(deg.ToRad())), math.Sin(float64(deg.ToRad()))}
 	o.yAxis = Vector{-o.xAxis.Y, o.xAxis.X}
 	return o
 }
@@ -91,7 +91,7 @@ func (o OBB) IsOverlap(b OBB) bool {
 	}
 
 	if !(o.xAxis.Projection(b.xAxis)*o.XHalfLength+o.yAxis.Projection(b.xAxis)*o.YHalfLength+
-		b.xAxis.Projection(b.xAxis)*b.YHalfLength > vectorOfCenters.Projection(b.xAxis)) {
+		b.xAxis.Projection(b.xAxis)*b.XHalfLength > vectorOfCenters.Projection(b.xAxis)) {
 		return false
 	}
 
@@ -103,14 +103,14 @@ func (o OBB) IsOverlap(b OBB) bool {
 	return true
 }
 
-func (o OBB) SymmetryXAxis() (r OBB) {
-	r.Center = o.Center.SymmetryXAxis()
-	r.deg = o.deg.SymmetryXAxis()
-	return r
+func (o OBB) SymmetryXAxis() OBB {
+	return o.Apply(util.Symmetry{Rotation: util.XInc, IsMirror: true})
 }
 
-func (o OBB) Transform(d1, d2 util.Direction) (r OBB) {
-	r.Center = o.Center.SymmetryXAxis()
-	r.deg = o.deg.SymmetryXAxis()
-	return r
+func (o OBB) Apply(s util.Symmetry) OBB {
+	return CreateOBB(s.Point(o.Center), o.XHalfLength, o.YHalfLength, s.Degree(o.deg))
+}
+
+func (o OBB) Transform(d1, d2 util.Direction) OBB {
+	return o.Apply(util.NewSymmetry(d1, d2))
 }
@@ -0,0 +1,94 @@
+package traffic
+
+import (
+	"log"
+	"traffic/route"
+	"traffic/util"
+)
+
+func (v *AGV) isLinkedWith(id int) bool {
+	for i := v.Current.Index; i < v.Trying.Index && i < len(v.Routes); i++ {
+		if pid, _, ok := v.Routes[i].LinkagePartner(); ok && pid == id {
+			return true
+		}
+	}
+	return false
+}
+
+func shiftIntPoint(p, offset util.IntPoint) util.IntPoint {
+	return util.IntPoint{X: p.X + offset.X, Y: p.Y + offset.Y}
+}
+
+func isLinkageMatch(sr, psr route.SubRoute, id int) bool {
+	pid, offset, ok := psr.LinkagePartner()
+	if !ok || pid != id {
+		return false
+	}
+	return shiftIntPoint(psr.Start, offset).Equal(sr.Start) && shiftIntPoint(psr.End, offset).Equal(sr.End)
+}
+
+func (c *Controller) decideLinkageClaim(v *AGV) {
+	sr := v.Routes[v.Claim.Index]
+	id, _, _ := sr.LinkagePartner()
+	p, ok := c.agvs[id]
+	if !ok || p.RunStatus != Run || p.Claim.Index >= len(p.Routes) {
+		log.Printf("<Controller.decideLinkageClaim> AGV %d wait for partner AGV %d\n", v.ID, id)
+		v.TryFailedCount++
+		return
+	}
+
+	psr := p.Routes[p.Claim.Index]
+	if psr.Type != route.Linkage || v.Current.Index != v.Claim.Index || p.Current.Index != p.Claim.Index {
+		log.Printf("<Controller.decideLinkageClaim> AGV %d blocked by partner AGV %d not at linkage, failed %d\n", v.ID, p.ID, v.TryFailedCount+1)
+		v.TryFailedCount++
+		return
+	}
+	// the pair is decided together, p skips its own turn in this cycle
+	c.linked[v.ID], c.linked[p.ID] = true, true
+
+	if !isLinkageMatch(sr, psr, v.ID) {
+		log.Printf("<Controller.decideLinkageClaim> AGV %d linkage %s not match partner AGV %d %s\n", v.ID, sr, p.ID, psr)
+		v.fault(ECLinkage, "linkage not match")
+		p.fault(ECLinkage, "linkage not match")
+		return
+	}
+
+	for _, q := range []*AGV{v, p} {
+		if err := q.leg.GrowSubRoute(q.Routes[q.Claim.Index]); err != nil {
+			log.Printf("<Controller.decideLinkageClaim> AGV %d sub route %d: %s\n", q.ID, q.Claim.Index, err)
+			v.ResetTrying()
+			p.ResetTrying()
+			q.fault(ECRoute, "linkage claim")
+			return
+		}
+		q.Trying = route.Mark{Index: q.Claim.Index + 1, Position: q.Routes[q.Claim.Index].End}
+	}
+
+	vBlocked := c.isTryingBlocked(v)
+	if pBlocked := c.isTryingBlocked(p); vBlocked || pBlocked {
+		for _, q := range []*AGV{v, p} {
+			failed := q.TryFailedCount + 1
+			q.ResetTrying()
+			q.TryFailedCount = failed
+		}
+		return
+	}
+
+	for _, q := range []*AGV{v, p} {
+		q.leg.ClaimTrying()
+		q.Claim = q.Trying
+		q.TryFailedCount = 0
+		q.linkSpeed = 0
+	}
+
+	_, vSpecial := v.peakSpeeds()
+	_, pSpecial := p.peakSpeeds()
+	v.linkSpeed, p.linkSpeed = vSpecial, vSpecial
+	if pSpecial < vSpecial {
+		v.linkSpeed, p.linkSpeed = pSpecial, pSpecial
+	}
+
+	log.Printf("<Controller.decideLinkageClaim> AGV %d and AGV %d claim linkage, speed %d\n", v.ID, p.ID, v.linkSpeed)
+	v.updateCommand(c.now)
+	p.updateCommand(c.now)
+}
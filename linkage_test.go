@@ -0,0 +1,35 @@
+package traffic
+
+import (
+	"testing"
+	"traffic/route"
+	"traffic/util"
+)
+
+func linkageRoute(start, end util.IntPoint, partner int, offset util.IntPoint) []route.SubRoute {
+	return []route.SubRoute{{Type: route.Linkage, MoveType: 90, Start: start, End: end, MaxSpeed: 800, IsEndStop: true,
+		RefParams: [6]int32{int32(partner), int32(offset.X), int32(offset.Y), 0, 0, 0}}}
+}
+
+func TestController_LinkageBlocked(t *testing.T) {
+	c := NewController()
+	for id := 1; id <= 3; id++ {
+		c.Register(id)
+	}
+	statuses := []AGVStatus{
+		{ID: 1, MotionStatus: MSStop, Pos: util.IntPoint{X: 0, Y: 0}},
+		{ID: 2, MotionStatus: MSStop, Pos: util.IntPoint{X: 3000, Y: 0}},
+		{ID: 3, MotionStatus: MSStop, Pos: util.IntPoint{X: 8000, Y: 0}},
+	}
+	c.Update(statuses)
+
+	c.SetRoutes(1, linkageRoute(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 10000, Y: 0}, 2, util.IntPoint{X: 3000, Y: 0}))
+	c.SetRoutes(2, linkageRoute(util.IntPoint{X: 3000, Y: 0}, util.IntPoint{X: 13000, Y: 0}, 1, util.IntPoint{X: -3000, Y: 0}))
+	c.Update(statuses)
+
+	v, _ := c.AGV(1)
+	p, _ := c.AGV(2)
+	if v.Claim.Index != 0 || v.TryFailedCount != 1 || p.TryFailedCount != 1 {
+		t.Errorf("want the pair blocked by AGV 3 once a cycle, failed %d and %d", v.TryFailedCount, p.TryFailedCount)
+	}
+}
@@ -0,0 +1,223 @@
+package path
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"traffic/route"
+	"traffic/track"
+	"traffic/util"
+)
+
+const (
+	gSampleCount        = 32
+	gTrackInterval      = 10
+	gMinDistance        = 0.5
+	gWheelbaseTolerance = 20
+)
+
+type Pose struct {
+	util.FloatPoint
+	Deg util.Degree
+	S   float64
+}
+
+type Path struct {
+	Poses     []Pose
+	Bounds    []float64
+	wheelbase float64
+	flip      util.Degree
+}
+
+func OfSubRoutes(srs []route.SubRoute, wheelbase float64) (*Path, error) {
+	p := &Path{Bounds: []float64{0}, wheelbase: wheelbase}
+	for i, sr := range srs {
+		if err := p.AppendSubRoute(sr); err != nil {
+			return nil, fmt.Errorf("Sub route %d: %s", i, err)
+		}
+	}
+	return p, nil
+}
+
+func (p *Path) Length() float64 {
+	if len(p.Poses) == 0 {
+		return 0
+	}
+	return p.Poses[len(p.Poses)-1].S
+}
+
+func (p *Path) IndexAt(s float64) int {
+	i := sort.Search(len(p.Bounds)-1, func(i int) bool { return p.Bounds[i+1] > s })
+	if i == len(p.Bounds)-1 {
+		i--
+	}
+	return i
+}
+
+func (p *Path) At(s float64) Pose {
+	i := sort.Search(len(p.Poses), func(i int) bool { return p.Poses[i].S >= s })
+	if i == 0 {
+		return p.Poses[0]
+	} else if i == len(p.Poses) {
+		return p.Poses[len(p.Poses)-1]
+	}
+
+	a, b := p.Poses[i-1], p.Poses[i]
+	k := (s - a.S) / (b.S - a.S)
+	diff := math.Remainder(float64(b.Deg-a.Deg), 360)
+	return Pose{
+		FloatPoint: util.FloatPoint{X: a.X + k*(b.X-a.X), Y: a.Y + k*(b.Y-a.Y)},
+		Deg:        (a.Deg + util.Degree(k*diff)).Normalize(),
+		S:          s,
+	}
+}
+
+func (p *Path) Project(q util.FloatPoint, from, to float64) (pose Pose, distance float64) {
+	distance = math.Inf(1)
+	for i := 1; i < len(p.Poses); i++ {
+		a, b := p.Poses[i-1], p.Poses[i]
+		if b.S < from || a.S > to || b.S == a.S {
+			continue
+		}
+
+		dx, dy := b.X-a.X, b.Y-a.Y
+		k := ((q.X-a.X)*dx + (q.Y-a.Y)*dy) / (dx*dx + dy*dy)
+		k = math.Max(0, math.Min(1, k))
+		s := math.Max(from, math.Min(to, a.S+k*(b.S-a.S)))
+
+		c := p.At(s)
+		if d := c.Distance(q); d < distance {
+			pose, distance = c, d
+		}
+	}
+	return pose, distance
+}
+
+func HeadingOf(from, to util.FloatPoint) util.Degree {
+	return util.Degree(math.Atan2(to.Y-from.Y, to.X-from.X) * 180 / math.Pi).Normalize()
+}
+
+func (p *Path) appendPose(q util.FloatPoint, deg util.Degree) {
+	deg += p.flip
+	s := 0.0
+	if len(p.Poses) > 0 {
+		last := p.Poses[len(p.Poses)-1]
+		d := last.Distance(q)
+		if d < gMinDistance && math.Abs(math.Remainder(float64(last.Deg-deg), 360)) < 1 {
+			return
+		}
+		s = last.S + d
+	}
+	p.Poses = append(p.Poses, Pose{FloatPoint: q, Deg: deg.Normalize(), S: s})
+}
+
+func (p *Path) appendLine(start, end util.FloatPoint, deg util.Degree) {
+	p.appendPose(start, deg)
+	p.appendPose(end, deg)
+}
+
+func (p *Path) appendCurve(fn func(t float64) util.FloatPoint, startDeg, endDeg util.Degree) {
+	p.appendPose(fn(0), startDeg)
+	for i := 1; i < gSampleCount; i++ {
+		prev := fn(float64(i-1) / gSampleCount)
+		next := fn(float64(i+1) / gSampleCount)
+		p.appendPose(fn(float64(i)/gSampleCount), HeadingOf(prev, next))
+	}
+	p.appendPose(fn(1), endDeg)
+}
+
+func (p *Path) AppendSubRoute(sr route.SubRoute) error {
+	in, assist := sr.InOutDirection()
+	if in == util.DirErr {
+		return fmt.Errorf("Unsupported sub route type %d", sr.Type)
+	}
+
+	p.flip = 0
+	if sr.IsAstern {
+		p.flip = 180
+	}
+
+	start := sr.Start.ToFloatPoint()
+	end := sr.End.ToFloatPoint()
+	p0 := sr.RefPoints[0].ToFloatPoint()
+	p1 := sr.RefPoints[1].ToFloatPoint()
+
+	switch sr.Type {
+	case route.Straight, route.Linkage:
+		p.appendLine(start, end, in.ToDegree())
+
+	case route.QTurn:
+		if !p.appendTrack(sr, in, assist) {
+			a := util.FloatPoint{X: p0.X - start.X, Y: p0.Y - start.Y}
+			b := util.FloatPoint{X: end.X - p0.X, Y: end.Y - p0.Y}
+			p.appendCurve(func(t float64) util.FloatPoint {
+				c, s := math.Cos(t*math.Pi/2), math.Sin(t*math.Pi/2)
+				return util.FloatPoint{X: start.X + b.X*(1-c) + a.X*s, Y: start.Y + b.Y*(1-c) + a.Y*s}
+			}, in.ToDegree(), assist.ToDegree())
+		}
+
+	case route.Oblique:
+		p.appendLine(start, end, in.ToDegree())
+
+	case route.UTurn:
+		p.appendLine(start, p0, in.ToDegree())
+		m := p0.CenterPoint(p1)
+		r := util.FloatPoint{X: p0.X - m.X, Y: p0.Y - m.Y}
+		u := in.Unit()
+		sign := 1.0
+		if u.X*(p1.Y-p0.Y)-u.Y*(p1.X-p0.X) < 0 {
+			sign = -1
+		}
+		p.appendCurve(func(t float64) util.FloatPoint {
+			c, s := math.Cos(sign*t*math.Pi), math.Sin(sign*t*math.Pi)
+			return util.FloatPoint{X: m.X + r.X*c - r.Y*s, Y: m.Y + r.X*s + r.Y*c}
+		}, in.ToDegree(), in.Opposite().ToDegree())
+		p.appendLine(p1, end, in.Opposite().ToDegree())
+
+	case route.STurn:
+		p.appendLine(start, p0, in.ToDegree())
+		u := in.Unit()
+		d := util.FloatPoint{X: p1.X - p0.X, Y: p1.Y - p0.Y}
+		long := d.X*u.X + d.Y*u.Y
+		lat := util.FloatPoint{X: d.X - long*u.X, Y: d.Y - long*u.Y}
+		p.appendCurve(func(t float64) util.FloatPoint {
+			k := t * t * (3 - 2*t)
+			return util.FloatPoint{X: p0.X + long*t*u.X + lat.X*k, Y: p0.Y + long*t*u.Y + lat.Y*k}
+		}, in.ToDegree(), in.ToDegree())
+		p.appendLine(p1, end, in.ToDegree())
+	}
+
+	p.Bounds = append(p.Bounds, p.Length())
+	return nil
+}
+
+func (p *Path) appendTrack(sr route.SubRoute, in, assist util.Direction) bool {
+	t, err := track.GetTrack(sr.MoveType)
+	if err != nil {
+		log.Printf("<Path.appendTrack> move type %d: %s\n", sr.MoveType, err)
+		return false
+	}
+
+	corner := sr.RefPoints[0].ToFloatPoint()
+	var poses []Pose
+	isValid := true
+	err = t.Walk(gTrackInterval, p.wheelbase, func(f, r util.FloatPoint) {
+		if !util.FloatEqualTolerance(f.Distance(r), p.wheelbase, gWheelbaseTolerance) {
+			isValid = false
+		}
+		c := f.CenterPoint(r).Transform(in, assist).Shift(corner)
+		poses = append(poses, Pose{FloatPoint: c, Deg: HeadingOf(r, f).Transform(in, assist)})
+	})
+	if err != nil || !isValid || len(poses) == 0 {
+		log.Printf("<Path.appendTrack> move type %d walk failed: %v, wheelbase valid %t\n", sr.MoveType, err, isValid)
+		return false
+	}
+
+	p.appendLine(sr.Start.ToFloatPoint(), poses[0].FloatPoint, in.ToDegree())
+	for _, q := range poses {
+		p.appendPose(q.FloatPoint, q.Deg)
+	}
+	p.appendLine(poses[len(poses)-1].FloatPoint, sr.End.ToFloatPoint(), assist.ToDegree())
+	return true
+}
@@ -0,0 +1,42 @@
+package path
+
+import (
+	"testing"
+	"traffic/route"
+	"traffic/util"
+)
+
+func TestOfSubRoutes(t *testing.T) {
+	p, err := OfSubRoutes([]route.SubRoute{
+		{Type: route.Straight, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 5000, Y: 0}},
+		{Type: route.Straight, Start: util.IntPoint{X: 5000, Y: 0}, End: util.IntPoint{X: 5000, Y: 3000}, IsAstern: true},
+	}, 1200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Bounds) != 3 || p.Bounds[1] != 5000 || p.Length() != 8000 {
+		t.Errorf("want bounds 0, 5000, 8000, result %v", p.Bounds)
+	}
+	if i := p.IndexAt(6000); i != 1 {
+		t.Errorf("want index 1 at 6000, result %d", i)
+	}
+	if pose := p.At(6000); !pose.Deg.Equal(270) {
+		t.Errorf("want astern heading 270, result %v", pose)
+	}
+
+	pose, d := p.Project(util.FloatPoint{X: 5100, Y: 1000}, 0, p.Length())
+	if !util.FloatEqual(pose.S, 6000) || !util.FloatEqual(d, 100) {
+		t.Errorf("want projected at 6000 distance 100, result %v %f", pose, d)
+	}
+
+	if pose, _ = p.Project(util.FloatPoint{X: 5000, Y: 2000}, 0, 5500); !util.FloatEqual(pose.S, 5500) {
+		t.Errorf("want projection clamped at 5500, result %v", pose)
+	}
+}
+
+func TestOfSubRoutes_Invalid(t *testing.T) {
+	if _, err := OfSubRoutes([]route.SubRoute{{Type: route.Invalid}}, 1200); err == nil {
+		t.Error("want error for invalid sub route")
+	}
+}
@@ -0,0 +1,198 @@
+package planner
+
+import (
+	"container/heap"
+	"fmt"
+	"log"
+	"traffic/layout"
+	"traffic/route"
+	"traffic/util"
+)
+
+const (
+	gQTurnPenalty   = 3000
+	gObliquePenalty = 2000
+	gUTurnPenalty   = 6000
+	gSTurnPenalty   = 2000
+)
+
+type state struct {
+	node    int
+	heading util.Direction
+}
+
+type item struct {
+	state
+	cost, priority float64
+	index          int
+}
+
+type queue []*item
+
+func (q queue) Len() int            { return len(q) }
+func (q queue) Less(i, j int) bool  { return q[i].priority < q[j].priority }
+func (q queue) Swap(i, j int)       { q[i], q[j] = q[j], q[i]; q[i].index = i; q[j].index = j }
+func (q *queue) Push(x interface{}) { it := x.(*item); it.index = len(*q); *q = append(*q, it) }
+func (q *queue) Pop() interface{} {
+	old := *q
+	it := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return it
+}
+
+type step struct {
+	prev           state
+	sr             route.SubRoute
+	depart, arrive float64
+}
+
+type Planner struct {
+	l *layout.Layout
+}
+
+func New(l *layout.Layout) *Planner {
+	return &Planner{l: l}
+}
+
+func SubRouteOfEdge(e layout.Edge, m layout.Move, start, end util.IntPoint) route.SubRoute {
+	return route.SubRoute{
+		Type:            m.RouteType(),
+		MoveType:        m.MoveType,
+		Start:           start,
+		End:             end,
+		MaxSpeed:        e.MaxSpeed,
+		MaxAcceleration: e.MaxAcceleration,
+		MaxDeceleration: e.MaxDeceleration,
+		IsEndStop:       e.IsStop,
+		IsAstern:        e.IsAstern,
+		RefParams:       m.RefParams,
+		RefPoints:       m.RefPoints,
+	}
+}
+
+func penalty(t int) float64 {
+	switch t {
+	case route.QTurn:
+		return gQTurnPenalty
+	case route.Oblique:
+		return gObliquePenalty
+	case route.UTurn:
+		return gUTurnPenalty
+	case route.STurn:
+		return gSTurnPenalty
+	default:
+		return 0
+	}
+}
+
+func headingAfter(sr route.SubRoute, heading util.Direction) (util.Direction, bool) {
+	in, assist := sr.InOutDirection()
+	if sr.IsAstern {
+		in, assist = in.Opposite(), assist.Opposite()
+	}
+	if in == util.DirErr || in != heading {
+		return util.DirErr, false
+	}
+
+	switch sr.Type {
+	case route.QTurn:
+		return assist, true
+	case route.UTurn:
+		return in.Opposite(), true
+	default:
+		return in, true
+	}
+}
+
+func (p *Planner) moves(s state, fn func(sr route.SubRoute, next state)) {
+	n, _ := p.l.Node(s.node)
+	for _, e := range p.l.OutEdges(s.node) {
+		next, _ := p.l.Node(e.To)
+		for _, m := range e.Moves {
+			sr := SubRouteOfEdge(e, m, n.Pos, next.Pos)
+			if h, ok := headingAfter(sr, s.heading); ok {
+				fn(sr, state{next.ID, h})
+			}
+		}
+	}
+}
+
+func (p *Planner) Plan(start util.IntPoint, heading util.Direction, target route.Mark) ([]route.SubRoute, error) {
+	log.Printf("<Planner.Plan> start (%d, %d) %s, target (%d, %d)\n", start.X, start.Y, heading, target.Position.X, target.Position.Y)
+	defer log.Println("<Planner.Plan> exit")
+
+	from, ok := p.l.NodeAt(start)
+	if !ok {
+		return nil, fmt.Errorf("Start (%d, %d) is not a node", start.X, start.Y)
+	}
+	to, ok := p.l.NodeAt(target.Position)
+	if !ok {
+		return nil, fmt.Errorf("Target (%d, %d) is not a node", target.Position.X, target.Position.Y)
+	}
+	if heading == util.DirErr {
+		return nil, fmt.Errorf("Invalid start heading")
+	}
+
+	goal := to.Pos.ToFloatPoint()
+	s0 := state{from.ID, heading}
+	costs := map[state]float64{s0: 0}
+	steps := make(map[state]step)
+	q := &queue{{state: s0, priority: from.Pos.ToFloatPoint().Distance(goal)}}
+
+	for q.Len() > 0 {
+		cur := heap.Pop(q).(*item)
+		if cur.cost > costs[cur.state] {
+			continue
+		}
+
+		if cur.node == to.ID {
+			return routesOf(trace(cur.state, s0, steps)), nil
+		}
+
+		p.moves(cur.state, func(sr route.SubRoute, ns state) {
+			cost := cur.cost + sr.Length() + penalty(sr.Type)
+			if c, ok := costs[ns]; ok && c <= cost {
+				return
+			}
+
+			next, _ := p.l.Node(ns.node)
+			costs[ns] = cost
+			steps[ns] = step{prev: cur.state, sr: sr}
+			heap.Push(q, &item{state: ns, cost: cost, priority: cost + next.Pos.ToFloatPoint().Distance(goal)})
+		})
+	}
+
+	return nil, fmt.Errorf("No route from (%d, %d) %s to (%d, %d)", start.X, start.Y, heading, target.Position.X, target.Position.Y)
+}
+
+func trace(s, s0 state, steps map[state]step) []step {
+	var sts []step
+	for s != s0 {
+		st := steps[s]
+		sts = append([]step{st}, sts...)
+		s = st.prev
+	}
+	return sts
+}
+
+func routesOf(sts []step) []route.SubRoute {
+	srs := make([]route.SubRoute, 0, len(sts))
+	for _, st := range sts {
+		srs = append(srs, st.sr)
+	}
+
+	for i := range srs {
+		if i == len(srs)-1 {
+			srs[i].IsEndStop = true
+		}
+
+		if i < len(srs)-1 && !srs[i].IsEndStop && srs[i+1].Type != route.Straight {
+			srs[i].IsContinuousLockWithNext = true
+		}
+		if i > 0 && srs[i-1].IsContinuousLockWithNext {
+			srs[i].IsContinuousLock = true
+		}
+	}
+
+	return srs
+}
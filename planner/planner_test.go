@@ -0,0 +1,183 @@
+package planner
+
+import (
+	"math"
+	"testing"
+	"time"
+	"traffic"
+	"traffic/layout"
+	"traffic/route"
+	"traffic/simulator"
+	"traffic/util"
+	"traffic/vehicle"
+)
+
+func loadPlanner(t *testing.T) *Planner {
+	var l layout.Layout
+	if err := l.LoadFromJSONFile("../layout/data/example.json"); err != nil {
+		t.Fatal(err)
+	}
+	return New(&l)
+}
+
+func TestPlanner_PlanQTurn(t *testing.T) {
+	p := loadPlanner(t)
+	srs, err := p.Plan(util.IntPoint{X: 0, Y: 0}, util.XInc, route.Mark{Position: util.IntPoint{X: 11300, Y: 6400}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types := []int{route.Straight, route.Straight, route.QTurn, route.Straight}
+	if len(srs) != len(types) {
+		t.Fatalf("want %d sub routes, result %v", len(types), srs)
+	}
+	for i, sr := range srs {
+		if sr.Type != types[i] {
+			t.Errorf("want sub route %d type %d, result %s", i, types[i], sr)
+		}
+	}
+
+	if !srs[1].IsContinuousLockWithNext || !srs[2].IsContinuousLock || srs[2].MoveType != 10 {
+		t.Errorf("want continuous lock into QTurn, result %v", srs)
+	}
+	if !srs[3].IsEndStop || !srs[3].End.Equal(util.IntPoint{X: 11300, Y: 6400}) {
+		t.Errorf("want end stop at target, result %s", srs[3])
+	}
+}
+
+func TestPlanner_PlanOblique(t *testing.T) {
+	p := loadPlanner(t)
+	srs, err := p.Plan(util.IntPoint{X: 0, Y: 0}, util.XInc, route.Mark{Position: util.IntPoint{X: 7500, Y: 1200}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(srs) != 2 || srs[1].Type != route.Oblique || srs[1].RefParams[0] != 1200 {
+		t.Errorf("want straight then oblique, result %v", srs)
+	}
+}
+
+func TestPlanner_PlanInfeasibleHeading(t *testing.T) {
+	p := loadPlanner(t)
+	if _, err := p.Plan(util.IntPoint{X: 0, Y: 0}, util.XDec, route.Mark{Position: util.IntPoint{X: 11300, Y: 6400}}); err == nil {
+		t.Error("want no route when heading away from target")
+	}
+	if _, err := p.Plan(util.IntPoint{X: 11300, Y: 6400}, util.YDec, route.Mark{Position: util.IntPoint{X: 0, Y: 0}}); err == nil {
+		t.Error("want no route through QTurn in reverse direction")
+	}
+}
+
+func TestPlanner_PlanFleet(t *testing.T) {
+	p := loadPlanner(t)
+	reqs := []Request{
+		{ID: 2, Priority: 1, Start: util.IntPoint{X: 0, Y: 0}, Heading: util.XInc, Target: route.Mark{Position: util.IntPoint{X: 10000, Y: 0}}},
+		{ID: 1, Priority: 2, Start: util.IntPoint{X: 5000, Y: 0}, Heading: util.XInc, Target: route.Mark{Position: util.IntPoint{X: 11300, Y: 6400}}},
+	}
+
+	ss, err := p.PlanFleet(reqs, NewReservationTable())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s1, s2 := ss[1], ss[2]
+	if len(s1.Routes) != 3 || s1.Departures[0] != 0 {
+		t.Errorf("want AGV 1 leave at once, result %v", s1)
+	}
+	if len(s2.Routes) != 2 || len(s2.Arrivals) != 2 {
+		t.Fatalf("want AGV 2 two sub routes, result %v", s2)
+	}
+
+	free := 10000.0 / 1500
+	if s2.Arrivals[1] <= free {
+		t.Errorf("want AGV 2 delayed after %.1fs, result %v", free, s2.Arrivals)
+	}
+	if !s2.Routes[0].IsEndStop && s2.Departures[1] > s2.Arrivals[0] {
+		t.Errorf("want AGV 2 stop before waiting, result %v", s2.Routes)
+	}
+}
+
+func TestReservationTable_IsFree(t *testing.T) {
+	rt := NewReservationTable()
+	rt.Reserve(1, body(&vehicle.Default, util.IntPoint{X: 0, Y: 0}, util.XInc), Window{0, 10})
+
+	o := body(&vehicle.Default, util.IntPoint{X: 500, Y: 0}, util.XInc)
+	if rt.IsFree(2, o, Window{5, 15}) {
+		t.Error("want overlapped window occupied")
+	}
+	if !rt.IsFree(2, o, Window{10, 20}) || !rt.IsFree(1, o, Window{5, 15}) {
+		t.Error("want later window and own reservation free")
+	}
+
+	rt.Release(1)
+	if !rt.IsFree(2, o, Window{5, 15}) {
+		t.Error("want released reservation free")
+	}
+}
+
+func TestDuration(t *testing.T) {
+	sr := route.SubRoute{Type: route.Straight, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 10000, Y: 0},
+		MaxSpeed: 1000, MaxAcceleration: 500, MaxDeceleration: 500}
+	// 2s to speed up, 8s at 1000 and 2s to stop
+	if d := duration(sr); !util.FloatEqualTolerance(d, 12, 0.01) {
+		t.Errorf("want 12s from stop to stop, result %.3f", d)
+	}
+}
+
+func TestPlanner_ReserveDriven(t *testing.T) {
+	p := loadPlanner(t)
+	req := Request{ID: 1, Start: util.IntPoint{X: 0, Y: 0}, Heading: util.XInc, Target: route.Mark{Position: util.IntPoint{X: 10000, Y: 0}}}
+	s, err := p.PlanWithReservation(req, NewReservationTable())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Routes) != 2 || s.Routes[0].IsEndStop {
+		t.Fatalf("want two sub routes without a stop between, result %v", s.Routes)
+	}
+
+	v := simulator.New(1, req.Start, 0)
+	if err := v.SetRoutes(s.Routes); err != nil {
+		t.Fatal(err)
+	}
+	last := s.Routes[len(s.Routes)-1]
+	cmd, _ := traffic.EncodeCommand(last)
+	if !v.Execute(cmd) {
+		t.Fatalf("execute command %v failed", cmd)
+	}
+
+	dt := 10 * time.Millisecond
+	arrivals := make([]float64, len(s.Routes))
+	for i, now := 0, 0.0; i < len(s.Routes) && now < 60; now += dt.Seconds() {
+		v.Step(dt)
+		if v.Position.X >= float64(s.Routes[i].End.X)-1 {
+			arrivals[i] = now + dt.Seconds()
+			i++
+		}
+	}
+
+	// the simulator stops within half a millimetre of the end, a little
+	// before the profile crawls to it
+	for i, a := range arrivals {
+		if math.Abs(a-s.Arrivals[i]) > 0.2 {
+			t.Errorf("want sub route %d reserved to arrive at %.2fs as driven, result %.2fs", i, a, s.Arrivals[i])
+		}
+	}
+}
+
+func TestPlanner_PlanModel(t *testing.T) {
+	p := loadPlanner(t)
+	rt := NewReservationTable()
+	rt.Reserve(2, body(&vehicle.Default, util.IntPoint{X: 13000, Y: 0}, util.XInc), Window{math.Inf(-1), math.Inf(1)})
+
+	req := Request{ID: 1, Start: util.IntPoint{X: 0, Y: 0}, Heading: util.XInc, Target: route.Mark{Position: util.IntPoint{X: 10000, Y: 0}}}
+	if _, err := p.PlanWithReservation(req, rt); err != nil {
+		t.Fatal(err)
+	}
+
+	long := vehicle.Default
+	long.Name = "long"
+	long.HalfLength = 2500
+	req.Model = &long
+	if s, err := p.PlanWithReservation(req, rt); err == nil {
+		t.Errorf("want long AGV blocked by AGV 2 at the target, result %v", s)
+	}
+}
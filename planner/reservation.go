@@ -0,0 +1,375 @@
+package planner
+
+import (
+	"container/heap"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"traffic/legume"
+	"traffic/route"
+	"traffic/util"
+	"traffic/vehicle"
+)
+
+const (
+	gDefaultSpeed = 1000
+	gWaitStep     = 1.0
+	gMaxWait      = 60.0
+	gSafetyTime   = 1.0
+	gLegumeSize   = 5000
+)
+
+type Window struct {
+	Start, End float64
+}
+
+func (w Window) IsOverlap(q Window) bool {
+	return w.Start < q.End && q.Start < w.End
+}
+
+type reservation struct {
+	id int
+	o  legume.OBB
+	w  Window
+}
+
+type ReservationTable struct {
+	entries []reservation
+}
+
+func NewReservationTable() *ReservationTable {
+	return &ReservationTable{}
+}
+
+func (rt *ReservationTable) Reserve(id int, o legume.OBB, w Window) {
+	rt.entries = append(rt.entries, reservation{id, o, w})
+}
+
+func (rt *ReservationTable) Release(id int) {
+	entries := rt.entries[:0]
+	for _, r := range rt.entries {
+		if r.id != id {
+			entries = append(entries, r)
+		}
+	}
+	rt.entries = entries
+}
+
+func (rt *ReservationTable) IsFree(id int, o legume.OBB, w Window) bool {
+	for _, r := range rt.entries {
+		if r.id == id || !r.w.IsOverlap(w) {
+			continue
+		}
+		if r.o.Center.Distance(o.Center) > reach(r.o)+reach(o) {
+			continue
+		}
+		if r.o.IsOverlap(o) {
+			return false
+		}
+	}
+	return true
+}
+
+type timedBean struct {
+	o legume.OBB
+	t float64
+}
+
+type Schedule struct {
+	ID                   int
+	Model                *vehicle.Model
+	Routes               []route.SubRoute
+	Departures, Arrivals []float64
+}
+
+type Request struct {
+	ID, Priority int
+	Model        *vehicle.Model // nil plans with vehicle.Default
+	Start        util.IntPoint
+	Heading      util.Direction
+	Target       route.Mark
+	At           float64
+}
+
+func (req Request) model() *vehicle.Model {
+	if req.Model == nil {
+		return &vehicle.Default
+	}
+	return req.Model
+}
+
+func body(m *vehicle.Model, p util.IntPoint, d util.Direction) legume.OBB {
+	return legume.CreateOBB(p.ToFloatPoint(), m.HalfLength, m.HalfWidth, d.ToDegree())
+}
+
+// reach bounds the distance from the centre of o to its corners.
+func reach(o legume.OBB) float64 {
+	return o.XHalfLength + o.YHalfLength
+}
+
+// duration is the time of a move from stop to stop, as the AGV drives it.
+func duration(sr route.SubRoute) float64 {
+	return route.NewProfile([]route.SubRoute{sr}, 0, 0, 0).Duration()
+}
+
+func beans(m *vehicle.Model, sr route.SubRoute) ([]legume.OBB, error) {
+	l := &legume.Legume{}
+	l.SetModel(m)
+	l.Init(gLegumeSize)
+	if err := l.GrowSubRoute(sr); err != nil {
+		return nil, err
+	}
+
+	var os []legume.OBB
+	start, end := l.Trying()
+	for r := start; r != end; r = r.Next() {
+		os = append(os, legume.BeanOBB(r))
+	}
+	return os, nil
+}
+
+// timedBeans times the beans of the sub route driven as seg of p, departing
+// at depart. The beans are even along the sub route, so a bean's arc length
+// follows its index.
+func timedBeans(os []legume.OBB, p route.Profile, seg route.Segment, depart float64) []timedBean {
+	tbs := make([]timedBean, 0, len(os))
+	for i, o := range os {
+		s := seg.S0
+		if len(os) > 1 {
+			s += (seg.S1 - seg.S0) * float64(i) / float64(len(os)-1)
+		}
+		tbs = append(tbs, timedBean{o, depart + p.TimeAt(s)})
+	}
+	return tbs
+}
+
+// runs calls fn for each run of s, the sub routes from one stop to the next
+// driven as one profile from the departure of the first of them.
+func (s Schedule) runs(fn func(first int, p route.Profile)) {
+	first := 0
+	for i, sr := range s.Routes {
+		if sr.IsEndStop || i == len(s.Routes)-1 {
+			fn(first, route.NewProfile(s.Routes[first:i+1], 0, 0, 0))
+			first = i + 1
+		}
+	}
+}
+
+// retime sets the departures and arrivals inside each run by its profile.
+func (s *Schedule) retime() {
+	s.runs(func(first int, p route.Profile) {
+		depart := s.Departures[first]
+		for j, seg := range p.Segments {
+			s.Departures[first+j] = depart + seg.Start
+			s.Arrivals[first+j] = depart + seg.ETA
+		}
+	})
+}
+
+func (s Schedule) reservations(start util.IntPoint, heading util.Direction, t0 float64) ([]reservation, error) {
+	if s.Model == nil {
+		s.Model = &vehicle.Default
+	}
+	tbss := make([][]timedBean, len(s.Routes))
+	var err error
+	s.runs(func(first int, p route.Profile) {
+		for j, seg := range p.Segments {
+			os, e := beans(s.Model, s.Routes[first+j])
+			if e != nil {
+				err = e
+				return
+			}
+			tbss[first+j] = timedBeans(os, p, seg, s.Departures[first])
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var rs []reservation
+	wait := body(s.Model, start, heading)
+	since := t0
+	for i, sr := range s.Routes {
+		rs = append(rs, reservation{s.ID, wait, Window{since - gSafetyTime, s.Departures[i] + gSafetyTime}})
+		for _, tb := range tbss[i] {
+			rs = append(rs, reservation{s.ID, tb.o, Window{tb.t - gSafetyTime, tb.t + gSafetyTime}})
+		}
+
+		heading, _ = headingAfter(sr, heading)
+		wait = body(s.Model, sr.End, heading)
+		since = s.Arrivals[i]
+	}
+
+	return append(rs, reservation{s.ID, wait, Window{since - gSafetyTime, math.Inf(1)}}), nil
+}
+
+func (rt *ReservationTable) isBeansFree(id int, tbs []timedBean) bool {
+	for _, tb := range tbs {
+		if !rt.IsFree(id, tb.o, Window{tb.t - gSafetyTime, tb.t + gSafetyTime}) {
+			return false
+		}
+	}
+	return true
+}
+
+func (rt *ReservationTable) ReserveSchedule(s Schedule, start util.IntPoint, heading util.Direction, t0 float64) error {
+	rs, err := s.reservations(start, heading, t0)
+	if err != nil {
+		return err
+	}
+	rt.entries = append(rt.entries, rs...)
+	return nil
+}
+
+// drive times s as the AGV drives it, one profile from a stop to the next.
+// The search times every move from stop to stop, so if the faster schedule
+// conflicts the AGV stops at every node, the timing the search checked.
+func (rt *ReservationTable) drive(s *Schedule, start util.IntPoint, heading util.Direction, t0 float64) error {
+	departures := append([]float64(nil), s.Departures...)
+	s.retime()
+	rs, err := s.reservations(start, heading, t0)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range rs {
+		if !rt.IsFree(r.id, r.o, r.w) {
+			log.Printf("<ReservationTable.drive> AGV %d conflict without stops, stop at every node\n", s.ID)
+			for i := range s.Routes {
+				s.Routes[i].IsEndStop = true
+				s.Routes[i].IsContinuousLock = false
+				s.Routes[i].IsContinuousLockWithNext = false
+			}
+			copy(s.Departures, departures)
+			s.retime()
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *Planner) maxSpeed() float64 {
+	v := float64(gDefaultSpeed)
+	for _, e := range p.l.Edges {
+		v = math.Max(v, float64(e.MaxSpeed))
+	}
+	return v
+}
+
+func (p *Planner) PlanWithReservation(req Request, rt *ReservationTable) (Schedule, error) {
+	log.Printf("<Planner.PlanWithReservation> AGV %d start (%d, %d) %s, target (%d, %d) at %.1fs\n",
+		req.ID, req.Start.X, req.Start.Y, req.Heading, req.Target.Position.X, req.Target.Position.Y, req.At)
+	defer log.Println("<Planner.PlanWithReservation> exit")
+
+	from, ok := p.l.NodeAt(req.Start)
+	if !ok {
+		return Schedule{}, fmt.Errorf("Start (%d, %d) is not a node", req.Start.X, req.Start.Y)
+	}
+	to, ok := p.l.NodeAt(req.Target.Position)
+	if !ok {
+		return Schedule{}, fmt.Errorf("Target (%d, %d) is not a node", req.Target.Position.X, req.Target.Position.Y)
+	}
+
+	m := req.model()
+	vmax := p.maxSpeed()
+	goal := to.Pos.ToFloatPoint()
+	s0 := state{from.ID, req.Heading}
+	arrivals := map[state]float64{s0: req.At}
+	steps := make(map[state]step)
+	q := &queue{{state: s0, cost: req.At, priority: req.At + from.Pos.ToFloatPoint().Distance(goal)/vmax}}
+	cache := make(map[route.SubRoute][]legume.OBB)
+	failed := make(map[route.SubRoute]bool)
+
+	for q.Len() > 0 {
+		cur := heap.Pop(q).(*item)
+		if cur.cost > arrivals[cur.state] {
+			continue
+		}
+
+		n, _ := p.l.Node(cur.node)
+		if cur.node == to.ID && rt.IsFree(req.ID, body(m, n.Pos, cur.heading), Window{cur.cost, math.Inf(1)}) {
+			sts := trace(cur.state, s0, steps)
+			s := Schedule{ID: req.ID, Model: m}
+			for i := range sts {
+				if i < len(sts)-1 && sts[i+1].depart > sts[i].arrive {
+					sts[i].sr.IsEndStop = true
+				}
+				s.Departures = append(s.Departures, sts[i].depart)
+				s.Arrivals = append(s.Arrivals, sts[i].arrive)
+			}
+			s.Routes = routesOf(sts)
+			if err := rt.drive(&s, req.Start, req.Heading, req.At); err != nil {
+				return Schedule{}, err
+			}
+			return s, nil
+		}
+
+		wait := body(m, n.Pos, cur.heading)
+		p.moves(cur.state, func(sr route.SubRoute, ns state) {
+			if failed[sr] {
+				return
+			}
+			os, ok := cache[sr]
+			if !ok {
+				var err error
+				if os, err = beans(m, sr); err != nil {
+					log.Printf("<Planner.PlanWithReservation> skip sub route %s: %s\n", sr, err)
+					failed[sr] = true
+					return
+				}
+				cache[sr] = os
+			}
+
+			d := duration(sr)
+			prof := route.NewProfile([]route.SubRoute{sr}, 0, 0, 0)
+			for depart := cur.cost; depart <= cur.cost+gMaxWait; depart += gWaitStep {
+				if !rt.IsFree(req.ID, wait, Window{cur.cost, depart + gSafetyTime}) {
+					return
+				}
+				if !rt.isBeansFree(req.ID, timedBeans(os, prof, prof.Segments[0], depart)) {
+					continue
+				}
+
+				arrive := depart + d
+				if a, ok := arrivals[ns]; ok && a <= arrive {
+					return
+				}
+
+				next, _ := p.l.Node(ns.node)
+				arrivals[ns] = arrive
+				steps[ns] = step{prev: cur.state, sr: sr, depart: depart, arrive: arrive}
+				heap.Push(q, &item{state: ns, cost: arrive, priority: arrive + next.Pos.ToFloatPoint().Distance(goal)/vmax})
+				return
+			}
+		})
+	}
+
+	return Schedule{}, fmt.Errorf("AGV %d no conflict free route to (%d, %d)", req.ID, req.Target.Position.X, req.Target.Position.Y)
+}
+
+func (p *Planner) PlanFleet(reqs []Request, rt *ReservationTable) (map[int]Schedule, error) {
+	sorted := append([]Request(nil), reqs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Priority > sorted[j].Priority })
+
+	for _, req := range sorted {
+		rt.Reserve(req.ID, body(req.model(), req.Start, req.Heading), Window{math.Inf(-1), math.Inf(1)})
+	}
+
+	schedules := make(map[int]Schedule)
+	for _, req := range sorted {
+		rt.Release(req.ID)
+
+		s, err := p.PlanWithReservation(req, rt)
+		if err != nil {
+			return schedules, err
+		}
+
+		if err = rt.ReserveSchedule(s, req.Start, req.Heading, req.At); err != nil {
+			return schedules, err
+		}
+		schedules[req.ID] = s
+	}
+
+	return schedules, nil
+}
@@ -0,0 +1,47 @@
+package traffic
+
+import (
+	"log"
+	"math"
+	"traffic/path"
+)
+
+const (
+	gProgressDistance = 300
+	gProgressHeading  = 30
+)
+
+type Progress struct {
+	Index  int
+	Offset float64
+}
+
+func (v *AGV) routePath() *path.Path {
+	if v.path == nil && len(v.Routes) > 0 {
+		p, err := path.OfSubRoutes(v.Routes, v.model().Wheelbase)
+		if err != nil {
+			log.Printf("<AGV.routePath> AGV %d: %s\n", v.ID, err)
+			return nil
+		}
+		v.path = p
+	}
+	return v.path
+}
+
+func (v *AGV) Progress() (Progress, bool) {
+	p := v.routePath()
+	if p == nil || v.Claim.Index == 0 {
+		return Progress{}, false
+	}
+
+	pose, d := p.Project(v.Position, p.Bounds[v.Current.Index], p.Bounds[v.Claim.Index])
+	if d > gProgressDistance || math.Abs(math.Remainder(float64(pose.Deg)-float64(v.Heading), 360)) > gProgressHeading {
+		return Progress{}, false
+	}
+
+	i := p.IndexAt(pose.S)
+	if i >= v.Claim.Index {
+		i = v.Claim.Index - 1
+	}
+	return Progress{Index: i, Offset: pose.S - p.Bounds[i]}, true
+}
@@ -0,0 +1,63 @@
+package traffic
+
+import (
+	"math"
+	"testing"
+	"traffic/route"
+	"traffic/util"
+)
+
+func turnRoutes() []route.SubRoute {
+	return []route.SubRoute{
+		{Type: route.Straight, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 10000, Y: 0}, MaxSpeed: 1000},
+		{Type: route.QTurn, MoveType: 10, Start: util.IntPoint{X: 10000, Y: 0}, End: util.IntPoint{X: 11300, Y: 1400}, MaxSpeed: 500,
+			RefParams: [6]int32{400, 700, 1300}, RefPoints: [2]util.IntPoint{{X: 11300, Y: 0}}},
+		{Type: route.Straight, Start: util.IntPoint{X: 11300, Y: 1400}, End: util.IntPoint{X: 11300, Y: 6400}, MaxSpeed: 1000, IsEndStop: true},
+	}
+}
+
+func TestAGV_UpdateCurrentMark(t *testing.T) {
+	v := &AGV{ID: 1, Routes: turnRoutes()}
+	v.Claim = route.Mark{Index: 3, Position: util.IntPoint{X: 11300, Y: 6400}}
+
+	v.Position, v.Heading = util.FloatPoint{X: 5000, Y: 0}, 0
+	v.UpdateCurrentMark()
+	if pr, ok := v.Progress(); !ok || v.Current.Index != 0 || pr.Index != 0 || math.Abs(pr.Offset-5000) > 1 {
+		t.Errorf("want on straight at 5000, current %v, progress %v", v.Current, pr)
+	}
+
+	p := v.routePath()
+	mid := p.At((p.Bounds[1] + p.Bounds[2]) / 2)
+	v.Position, v.Heading = mid.FloatPoint, int(mid.Deg)
+	v.UpdateCurrentMark()
+	if pr, ok := v.Progress(); !ok || v.Current.Index != 1 || pr.Index != 1 {
+		t.Errorf("want in QTurn at %v, current %v, progress %v", mid, v.Current, pr)
+	}
+
+	v.Position, v.Heading = util.FloatPoint{X: 11300, Y: 3000}, 90
+	v.UpdateCurrentMark()
+	if v.Current.Index != 2 {
+		t.Errorf("want on last straight, current %v", v.Current)
+	}
+
+	v.Position, v.Heading = util.FloatPoint{X: 11300, Y: 6400}, 90
+	v.UpdateCurrentMark()
+	if v.Current.Index != 3 {
+		t.Errorf("want passed all sub routes, current %v", v.Current)
+	}
+}
+
+func TestAGV_ProgressOffRoute(t *testing.T) {
+	v := &AGV{ID: 1, Routes: turnRoutes()}
+	v.Claim = route.Mark{Index: 3}
+
+	v.Position, v.Heading = util.FloatPoint{X: 5000, Y: 1000}, 0
+	if pr, ok := v.Progress(); ok {
+		t.Errorf("want off route, progress %v", pr)
+	}
+
+	v.Position, v.Heading = util.FloatPoint{X: 5000, Y: 0}, 180
+	if pr, ok := v.Progress(); ok {
+		t.Errorf("want heading mismatch, progress %v", pr)
+	}
+}
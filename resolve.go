@@ -0,0 +1,146 @@
+package traffic
+
+import (
+	"log"
+	"traffic/route"
+)
+
+const (
+	ResolveWait = iota
+	ResolveReroute
+	ResolveBackOff
+)
+
+type Resolution struct {
+	ID, Action int
+	Routes     []route.SubRoute
+}
+
+type DeadlockResolver interface {
+	Resolve(d Deadlock, agvs []AGV) Resolution
+}
+
+type PriorityResolver struct {
+	Reroute func(v AGV, blockers []int) ([]route.SubRoute, bool)
+}
+
+func (pr PriorityResolver) Resolve(d Deadlock, agvs []AGV) Resolution {
+	victim := agvs[0]
+	for _, v := range agvs[1:] {
+		if v.Priority < victim.Priority || v.Priority == victim.Priority && v.ID > victim.ID {
+			victim = v
+		}
+	}
+
+	if pr.Reroute != nil {
+		var blockers []int
+		for _, w := range d.Edges {
+			if w.ID == victim.ID {
+				blockers = append(blockers, w.BlockerID)
+			}
+		}
+
+		if routes, ok := pr.Reroute(victim, blockers); ok {
+			return Resolution{ID: victim.ID, Action: ResolveReroute, Routes: routes}
+		}
+	}
+
+	if routes, ok := victim.backOffRoutes(); ok {
+		return Resolution{ID: victim.ID, Action: ResolveBackOff, Routes: routes}
+	}
+
+	return Resolution{ID: victim.ID, Action: ResolveWait}
+}
+
+func (v AGV) backOffRoutes() ([]route.SubRoute, bool) {
+	if v.Current.Index >= len(v.Routes) {
+		return nil, false
+	}
+
+	i := v.Current.Index - 1
+	for i >= 0 && !v.Routes[i].IsEndStop {
+		i--
+	}
+
+	stop := v.Routes[i+1].Start
+	for j := i + 1; j <= v.Current.Index; j++ {
+		if v.Routes[j].Type != route.Straight {
+			return nil, false
+		}
+	}
+
+	if v.Position.Distance(stop.ToFloatPoint()) < v.model().ToleranceVertical {
+		return nil, false
+	}
+
+	sr := v.Routes[v.Current.Index]
+	p := v.Position.ToIntPoint()
+	if sr.Start.X == sr.End.X {
+		p.X = stop.X
+	} else {
+		p.Y = stop.Y
+	}
+
+	backOff := route.SubRoute{
+		Type:            route.Straight,
+		Start:           p,
+		End:             stop,
+		MaxSpeed:        sr.MaxSpeed,
+		MaxAcceleration: sr.MaxAcceleration,
+		MaxDeceleration: sr.MaxDeceleration,
+		IsEndStop:       true,
+		IsAstern:        !sr.IsAstern,
+	}
+
+	return append([]route.SubRoute{backOff}, v.Routes[i+1:]...), true
+}
+
+func (c *Controller) SetDeadlockResolver(r DeadlockResolver) {
+	c.resolver = r
+}
+
+func (c *Controller) resolveDeadlock() {
+	if c.resolver == nil {
+		return
+	}
+
+	for _, d := range c.deadlocks {
+		agvs := make([]AGV, 0, len(d.IDs))
+		for _, id := range d.IDs {
+			agvs = append(agvs, *c.agvs[id])
+		}
+
+		res := c.resolver.Resolve(d, agvs)
+		v, ok := c.agvs[res.ID]
+		if !ok {
+			log.Printf("<Controller.resolveDeadlock> can't find AGV %d in deadlock %v\n", res.ID, d.IDs)
+			continue
+		}
+
+		log.Printf("<Controller.resolveDeadlock> deadlock AGV %v, AGV %d action %d, failed %d\n",
+			d.IDs, v.ID, res.Action, v.TryFailedCount)
+		v.ResetTrying()
+
+		if (res.Action == ResolveReroute || res.Action == ResolveBackOff) && len(res.Routes) > 0 {
+			v.replaceRoutes(res.Routes)
+		}
+	}
+}
+
+// replaceRoutes keeps claimed the sub routes the replaced command may still
+// drive into until the first command on the new routes is acked, and drops
+// the pending commands so none of them is retransmitted.
+func (v *AGV) replaceRoutes(routes []route.SubRoute) {
+	if v.Current.Index < v.Claim.Index {
+		v.held = append(v.held, v.Routes[v.Current.Index:v.Claim.Index]...)
+		v.heldSeq = 0
+	}
+	v.pending = nil
+	v.Routes = routes
+	v.path = nil
+	v.Current.Index = 0
+	v.Claim = route.Mark{Index: 0, Position: v.Position.ToIntPoint()}
+	v.CommandRM = v.Claim
+	v.Trying = v.Claim
+	v.Target = route.Mark{Index: len(routes), Position: routes[len(routes)-1].End}
+}
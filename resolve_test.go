@@ -0,0 +1,103 @@
+package traffic
+
+import (
+	"testing"
+	"time"
+	"traffic/route"
+	"traffic/util"
+)
+
+func headOnController(pos2 util.IntPoint, r DeadlockResolver) *Controller {
+	c := NewController()
+	c.SetDeadlockResolver(r)
+	c.Register(1)
+	c.Register(2)
+	c.Update([]AGVStatus{
+		{ID: 1, MotionStatus: MSStop, Priority: 2, Pos: util.IntPoint{X: 0, Y: 0}},
+		{ID: 2, MotionStatus: MSStop, Priority: 1, Heading: 180, Pos: util.IntPoint{X: 10000, Y: 0}},
+	})
+	c.SetRoutes(1, straightRoutes(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 10000, Y: 0}))
+	c.SetRoutes(2, []route.SubRoute{
+		{Type: route.Straight, Start: util.IntPoint{X: 10000, Y: 0}, End: util.IntPoint{X: 8000, Y: 0}, MaxSpeed: 1000},
+		{Type: route.Straight, Start: util.IntPoint{X: 8000, Y: 0}, End: util.IntPoint{X: 0, Y: 0}, MaxSpeed: 1000, IsEndStop: true},
+	})
+
+	v, _ := c.AGV(2)
+	v.Current.Index = 1
+	v.Claim.Index = 1
+	c.Update([]AGVStatus{{ID: 2, MotionStatus: MSStop, Priority: 1, Heading: 180, Pos: pos2}})
+	return c
+}
+
+func TestPriorityResolver_BackOff(t *testing.T) {
+	c := headOnController(util.IntPoint{X: 7000, Y: 0}, PriorityResolver{})
+
+	v, _ := c.AGV(2)
+	if len(c.Deadlocks()) != 1 || len(v.Routes) != 3 || !v.Routes[0].End.Equal(util.IntPoint{X: 10000, Y: 0}) || !v.Routes[0].IsAstern {
+		t.Errorf("want AGV 2 back off to (10000, 0), routes %v", v.Routes)
+	}
+	if v.TryFailedCount != 0 || v.Claim.Index != 0 {
+		t.Errorf("want AGV 2 trying reset, claim %v, failed %d", v.Claim, v.TryFailedCount)
+	}
+}
+
+func TestPriorityResolver_Reroute(t *testing.T) {
+	detour := straightRoutes(util.IntPoint{X: 7000, Y: 0}, util.IntPoint{X: 7000, Y: 5000})
+	r := PriorityResolver{Reroute: func(v AGV, blockers []int) ([]route.SubRoute, bool) {
+		if v.ID != 2 || len(blockers) != 1 || blockers[0] != 1 {
+			t.Errorf("want AGV 2 blocked by AGV 1, result AGV %d blockers %v", v.ID, blockers)
+		}
+		return detour, true
+	}}
+	c := headOnController(util.IntPoint{X: 7000, Y: 0}, r)
+
+	v, _ := c.AGV(2)
+	if len(v.Routes) != 1 || !v.Target.Position.Equal(util.IntPoint{X: 7000, Y: 5000}) {
+		t.Errorf("want AGV 2 rerouted, routes %v", v.Routes)
+	}
+}
+
+func TestController_BackOffHoldsClaim(t *testing.T) {
+	c := NewController()
+	c.SetDeadlockResolver(PriorityResolver{})
+	c.Register(1)
+	c.Register(2)
+	statuses := []AGVStatus{
+		{ID: 1, MotionStatus: MSStop, Priority: 2, Pos: util.IntPoint{X: 0, Y: 0}},
+		{ID: 2, MotionStatus: MSStop, Priority: 1, Heading: 180, Pos: util.IntPoint{X: 7000, Y: 0}},
+	}
+	c.Update(statuses)
+	c.SetRoutes(1, straightRoutes(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 5000, Y: 0}))
+	c.SetRoutes(2, []route.SubRoute{
+		{Type: route.Straight, Start: util.IntPoint{X: 10000, Y: 0}, End: util.IntPoint{X: 8000, Y: 0}, MaxSpeed: 1000},
+		{Type: route.Straight, Start: util.IntPoint{X: 8000, Y: 0}, End: util.IntPoint{X: 6000, Y: 0}, MaxSpeed: 1000},
+		{Type: route.Straight, Start: util.IntPoint{X: 6000, Y: 0}, End: util.IntPoint{X: 0, Y: 0}, MaxSpeed: 1000, IsEndStop: true},
+	})
+
+	// AGV 2 drives on the claim up to (6000, 0)
+	v, _ := c.AGV(2)
+	v.Current.Index, v.Claim.Index = 1, 2
+	v.issueCommand(AGVCommand{Type: route.Straight, Target: util.IntPoint{X: 6000, Y: 0}}, time.Now())
+	v.CommandRM = v.Claim
+	c.Update(statuses)
+
+	if len(c.Deadlocks()) != 1 || !v.Routes[0].IsAstern || len(v.Pending()) != 0 {
+		t.Fatalf("want AGV 2 back off with no pending command, routes %v pending %v", v.Routes, v.Pending())
+	}
+
+	results := c.Update(statuses)
+	w, _ := c.AGV(1)
+	if w.Claim.Index != 0 {
+		t.Errorf("want AGV 1 blocked until AGV 2 acks the back off, claim %v", w.Claim)
+	}
+
+	seq := results[1].Command.Seq
+	if seq == 0 || !results[1].Command.Target.Equal(util.IntPoint{X: 10000, Y: 0}) {
+		t.Fatalf("want back off command, result %v", results[1].Command)
+	}
+	statuses[1].ControlCode = seq
+	c.Update(statuses)
+	if w.Claim.Index != 1 {
+		t.Errorf("want AGV 1 claim after the ack, claim %v", w.Claim)
+	}
+}
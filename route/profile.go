@@ -0,0 +1,209 @@
+package route
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+)
+
+const (
+	gDefaultSpeed        = 1000
+	gDefaultAcceleration = 500
+)
+
+type Phase struct {
+	T0, T1, S0, S1, V0, V1, A float64
+}
+
+type Segment struct {
+	Index               int
+	S0, S1, V0, V1      float64
+	MaxSpeed, PeakSpeed float64
+	Start, ETA          float64
+	Phases              []Phase
+	deceleration        float64
+}
+
+type Profile struct {
+	Segments []Segment
+}
+
+func (p Profile) String() string {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func (sr SubRoute) SpeedLimit(maxStraightSpeed, maxSpecialSpeed int) float64 {
+	limit := maxSpecialSpeed
+	if sr.Type == Straight {
+		limit = maxStraightSpeed
+	}
+	if sr.MaxSpeed > 0 && (limit <= 0 || sr.MaxSpeed < limit) {
+		limit = sr.MaxSpeed
+	}
+
+	if limit <= 0 {
+		limit = gDefaultSpeed
+	}
+	return float64(limit)
+}
+
+func (sr SubRoute) Acceleration() (acc, dec float64) {
+	acc, dec = float64(sr.MaxAcceleration), float64(sr.MaxDeceleration)
+	if acc <= 0 {
+		acc = gDefaultAcceleration
+	}
+	if dec <= 0 {
+		dec = gDefaultAcceleration
+	}
+	return acc, dec
+}
+
+func NewProfile(srs []SubRoute, v0 float64, maxStraightSpeed, maxSpecialSpeed int) Profile {
+	lengths := make([]float64, len(srs))
+	for i, sr := range srs {
+		lengths[i] = sr.Length()
+	}
+	return NewProfileOfLength(srs, lengths, v0, maxStraightSpeed, maxSpecialSpeed)
+}
+
+func NewProfileOfLength(srs []SubRoute, lengths []float64, v0 float64, maxStraightSpeed, maxSpecialSpeed int) Profile {
+	n := len(srs)
+	vmax := make([]float64, n)
+	acc := make([]float64, n)
+	dec := make([]float64, n)
+	for i, sr := range srs {
+		vmax[i] = sr.SpeedLimit(maxStraightSpeed, maxSpecialSpeed)
+		acc[i], dec[i] = sr.Acceleration()
+	}
+
+	vb := make([]float64, n+1)
+	if n > 0 {
+		vb[0] = math.Min(math.Max(v0, 0), vmax[0])
+	}
+	for i := 1; i < n; i++ {
+		if !srs[i-1].IsEndStop {
+			vb[i] = math.Min(vmax[i-1], vmax[i])
+		}
+	}
+	for i := 0; i < n; i++ {
+		vb[i+1] = math.Min(vb[i+1], math.Sqrt(vb[i]*vb[i]+2*acc[i]*lengths[i]))
+	}
+	for i := n - 1; i >= 0; i-- {
+		vb[i] = math.Min(vb[i], math.Sqrt(vb[i+1]*vb[i+1]+2*dec[i]*lengths[i]))
+	}
+
+	var p Profile
+	t, s := 0.0, 0.0
+	for i := range srs {
+		seg := trapezoid(lengths[i], vb[i], vb[i+1], vmax[i], acc[i], dec[i], s, t)
+		seg.Index = i
+		p.Segments = append(p.Segments, seg)
+		t, s = seg.ETA, seg.S1
+	}
+
+	return p
+}
+
+func trapezoid(l, v0, v1, vmax, acc, dec, s, t float64) Segment {
+	seg := Segment{S0: s, S1: s + l, V0: v0, V1: v1, MaxSpeed: vmax, Start: t, ETA: t, deceleration: dec}
+	if l <= 0 {
+		seg.PeakSpeed = math.Max(v0, v1)
+		return seg
+	}
+
+	vc := math.Sqrt((2*acc*dec*l + dec*v0*v0 + acc*v1*v1) / (acc + dec))
+	vc = math.Max(math.Min(vc, vmax), math.Max(v0, v1))
+	seg.PeakSpeed = vc
+
+	da := (vc*vc - v0*v0) / (2 * acc)
+	dd := (vc*vc - v1*v1) / (2 * dec)
+	dc := math.Max(l-da-dd, 0)
+
+	seg.appendPhase(v0, vc, acc, da)
+	if vc > 0 {
+		seg.appendPhase(vc, vc, 0, dc)
+	}
+	seg.appendPhase(vc, v1, -dec, dd)
+	return seg
+}
+
+func (seg *Segment) appendPhase(v0, v1, a, ds float64) {
+	if ds <= 0 {
+		return
+	}
+
+	dt := ds / v0
+	if a != 0 {
+		dt = (v1 - v0) / a
+	}
+	s0 := seg.S0
+	if len(seg.Phases) > 0 {
+		s0 = seg.Phases[len(seg.Phases)-1].S1
+	}
+	seg.Phases = append(seg.Phases, Phase{T0: seg.ETA, T1: seg.ETA + dt, S0: s0, S1: s0 + ds, V0: v0, V1: v1, A: a})
+	seg.ETA += dt
+}
+
+func (p Profile) Duration() float64 {
+	if len(p.Segments) == 0 {
+		return 0
+	}
+	return p.Segments[len(p.Segments)-1].ETA
+}
+
+func (p Profile) Length() float64 {
+	if len(p.Segments) == 0 {
+		return 0
+	}
+	return p.Segments[len(p.Segments)-1].S1
+}
+
+func (p Profile) At(t float64) (s, v float64) {
+	for _, seg := range p.Segments {
+		for _, ph := range seg.Phases {
+			if t > ph.T1 {
+				continue
+			}
+			dt := math.Max(t-ph.T0, 0)
+			return ph.S0 + ph.V0*dt + ph.A*dt*dt/2, ph.V0 + ph.A*dt
+		}
+	}
+
+	if len(p.Segments) == 0 {
+		return 0, 0
+	}
+	last := p.Segments[len(p.Segments)-1]
+	return last.S1, last.V1
+}
+
+// TimeAt is the time the profile reaches arc length s, the inverse of At.
+func (p Profile) TimeAt(s float64) float64 {
+	for _, seg := range p.Segments {
+		for _, ph := range seg.Phases {
+			if s > ph.S1 {
+				continue
+			}
+			ds := math.Max(s-ph.S0, 0)
+			if ph.A == 0 {
+				return ph.T0 + ds/ph.V0
+			}
+			v := math.Sqrt(math.Max(ph.V0*ph.V0+2*ph.A*ds, 0))
+			return ph.T0 + (v-ph.V0)/ph.A
+		}
+	}
+	return p.Duration()
+}
+
+func (p Profile) SpeedLimitAt(s float64) float64 {
+	i := sort.Search(len(p.Segments), func(i int) bool { return p.Segments[i].S1 > s })
+	if i == len(p.Segments) {
+		return 0
+	}
+
+	seg := p.Segments[i]
+	return math.Min(seg.MaxSpeed, math.Sqrt(seg.V1*seg.V1+2*seg.deceleration*math.Max(seg.S1-s, 0)))
+}
@@ -0,0 +1,70 @@
+package route
+
+import (
+	"testing"
+	"traffic/util"
+)
+
+func TestProfile_Trapezoid(t *testing.T) {
+	srs := []SubRoute{
+		{Type: Straight, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 10000, Y: 0}, MaxSpeed: 1000, MaxAcceleration: 500, MaxDeceleration: 500},
+	}
+
+	p := NewProfile(srs, 0, 0, 0)
+	if !util.FloatEqual(p.Duration(), 12) || !util.FloatEqual(p.Segments[0].PeakSpeed, 1000) {
+		t.Errorf("want 12s cruising at 1000, result %s", p)
+	}
+	if len(p.Segments[0].Phases) != 3 {
+		t.Errorf("want accel, cruise and decel phases, result %s", p)
+	}
+
+	if s, v := p.At(1); !util.FloatEqual(s, 250) || !util.FloatEqual(v, 500) {
+		t.Errorf("want (250, 500) at 1s, result (%f, %f)", s, v)
+	}
+	if s, v := p.At(6); !util.FloatEqual(s, 5000) || !util.FloatEqual(v, 1000) {
+		t.Errorf("want (5000, 1000) at 6s, result (%f, %f)", s, v)
+	}
+	if s, v := p.At(20); !util.FloatEqual(s, 10000) || v != 0 {
+		t.Errorf("want stop at end, result (%f, %f)", s, v)
+	}
+
+	for _, c := range []struct{ s, t float64 }{{0, 0}, {250, 1}, {5000, 6}, {9750, 11}, {10000, 12}} {
+		if r := p.TimeAt(c.s); !util.FloatEqual(r, c.t) {
+			t.Errorf("want %.0f at %.0f, result %f", c.t, c.s, r)
+		}
+	}
+}
+
+func TestProfile_EndStop(t *testing.T) {
+	srs := []SubRoute{
+		{Type: Straight, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 500, Y: 0}, MaxSpeed: 1000, IsEndStop: true},
+		{Type: Straight, Start: util.IntPoint{X: 500, Y: 0}, End: util.IntPoint{X: 1000, Y: 0}, MaxSpeed: 1000},
+	}
+
+	p := NewProfile(srs, 0, 0, 0)
+	if p.Segments[0].V1 != 0 || !util.FloatEqual(p.Segments[0].PeakSpeed, 500) {
+		t.Errorf("want stop between sub routes, result %s", p)
+	}
+	if !util.FloatEqual(p.Segments[0].ETA, 2) || !util.FloatEqual(p.Duration(), 4) {
+		t.Errorf("want ETA 2s and 4s, result %s", p)
+	}
+
+	srs[0].IsEndStop = false
+	p = NewProfile(srs, 0, 0, 0)
+	if !util.FloatEqual(p.Segments[0].V1, 707.1067811865476) || p.Duration() >= 4 {
+		t.Errorf("want pass through without stop, result %s", p)
+	}
+	if !util.FloatEqual(p.SpeedLimitAt(750), 500) {
+		t.Errorf("want speed limit 500 at 750, result %f", p.SpeedLimitAt(750))
+	}
+}
+
+func TestSubRoute_SpeedLimit(t *testing.T) {
+	sr := SubRoute{Type: QTurn, MaxSpeed: 500}
+	if sr.SpeedLimit(1500, 800) != 500 || sr.SpeedLimit(1500, 300) != 300 {
+		t.Error("want special speed capped by sub route")
+	}
+	if sr = (SubRoute{Type: Straight}); sr.SpeedLimit(0, 0) != gDefaultSpeed {
+		t.Error("want default speed without limits")
+	}
+}
@@ -2,6 +2,8 @@ package route
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"traffic/util"
 )
 
@@ -22,6 +24,7 @@ type SubRoute struct {
 	Start, End                                            util.IntPoint
 	MaxSpeed, MaxAcceleration, MaxDeceleration            int
 	IsContinuousLock, IsContinuousLockWithNext, IsEndStop bool
+	IsAstern                                              bool
 	RefParams                                             [6]int32
 	RefPoints                                             [2]util.IntPoint
 }
@@ -46,7 +49,7 @@ const (
 
 func (sr SubRoute) InOutDirection() (in, assist util.Direction) {
 	switch sr.Type {
-	case Straight:
+	case Straight, Linkage:
 		if sr.Start.X == sr.End.X {
 			if sr.Start.Y < sr.End.Y {
 				return util.YInc, util.YInc
@@ -54,7 +57,7 @@ func (sr SubRoute) InOutDirection() (in, assist util.Direction) {
 				return util.YDec, util.YDec
 			}
 		} else {
-			if sr.Start.Y < sr.End.Y {
+			if sr.Start.X < sr.End.X {
 				return util.XInc, util.XInc
 			} else {
 				return util.XDec, util.XDec
@@ -113,7 +116,7 @@ func (sr SubRoute) InOutDirection() (in, assist util.Direction) {
 
 	case UTurn:
 		if sr.Start.X == sr.RefPoints[0].X {
-			if sr.Start.Y < sr.RefPoints[1].X {
+			if sr.Start.Y < sr.RefPoints[0].Y {
 				in = util.YInc
 			} else {
 				in = util.YDec
@@ -172,7 +175,7 @@ func (sr SubRoute) HeadingOnSubRoute(p util.IntPoint, isAstern bool) (d util.Deg
 	in, assist := sr.InOutDirection()
 
 	switch sr.Type {
-	case Straight:
+	case Straight, Linkage:
 		d = in.ToDegree()
 
 	case QTurn:
@@ -205,3 +208,53 @@ func (sr SubRoute) HeadingOnSubRoute(p util.IntPoint, isAstern bool) (d util.Deg
 		return d
 	}
 }
+
+func (sr SubRoute) LinkagePartner() (id int, offset util.IntPoint, ok bool) {
+	if sr.Type != Linkage {
+		return 0, util.IntPoint{}, false
+	}
+	return int(sr.RefParams[0]), util.IntPoint{X: int(sr.RefParams[1]), Y: int(sr.RefParams[2])}, true
+}
+
+func (sr SubRoute) Length() float64 {
+	switch sr.Type {
+	case QTurn:
+		return sr.Start.ToFloatPoint().Distance(sr.RefPoints[0].ToFloatPoint()) +
+			sr.RefPoints[0].ToFloatPoint().Distance(sr.End.ToFloatPoint())
+	case UTurn, STurn:
+		return sr.Start.ToFloatPoint().Distance(sr.RefPoints[0].ToFloatPoint()) +
+			sr.RefPoints[0].ToFloatPoint().Distance(sr.RefPoints[1].ToFloatPoint()) +
+			sr.RefPoints[1].ToFloatPoint().Distance(sr.End.ToFloatPoint())
+	default:
+		return sr.Start.ToFloatPoint().Distance(sr.End.ToFloatPoint())
+	}
+}
+
+// MaxCurvature returns the sharpest bend of a UTurn or STurn between its ref
+// points, the UTurn is a half circle and the STurn a smoothstep lane change.
+func (sr SubRoute) MaxCurvature() (float64, error) {
+	p0, p1 := sr.RefPoints[0].ToFloatPoint(), sr.RefPoints[1].ToFloatPoint()
+
+	switch sr.Type {
+	case UTurn:
+		d := p0.Distance(p1)
+		if d == 0 {
+			return 0, fmt.Errorf("UTurn at (%d, %d) without diameter", sr.RefPoints[0].X, sr.RefPoints[0].Y)
+		}
+		return 2 / d, nil
+
+	case STurn:
+		in, _ := sr.InOutDirection()
+		u := in.Unit()
+		long := (p1.X-p0.X)*u.X + (p1.Y-p0.Y)*u.Y
+		lat := (p1.Y-p0.Y)*u.X - (p1.X-p0.X)*u.Y
+		if long == 0 {
+			return 0, fmt.Errorf("STurn at (%d, %d) without length", sr.RefPoints[0].X, sr.RefPoints[0].Y)
+		}
+		// lat*(3t^2-2t^3) over long*t bends most at both ends
+		return 6 * math.Abs(lat) / (long * long), nil
+
+	default:
+		return 0, fmt.Errorf("Sub route type %d has no curvature", sr.Type)
+	}
+}
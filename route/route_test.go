@@ -3,20 +3,21 @@ package route
 import (
 	"log"
 	"testing"
+	"traffic/util"
 )
 
 func TestSubRoute_InOutDirection_QTurn(t *testing.T) {
 	sr := SubRoute{
 		Type:      QTurn,
 		MoveType:  10,
-		Start:     Point{199050, 22600},
-		End:       Point{200350, 24000},
+		Start:     util.IntPoint{X: 199050, Y: 22600},
+		End:       util.IntPoint{X: 200350, Y: 24000},
 		RefParams: [6]int32{400, 700, 1300, 0, 0, 0},
-		RefPoints: [2]Point{{200350, 22600}, {0, 0}},
+		RefPoints: [2]util.IntPoint{{X: 200350, Y: 22600}, {}},
 	}
 
 	in, out := sr.InOutDirection()
-	if in != XInc || out != YInc {
+	if in != util.XInc || out != util.YInc {
 		t.Errorf("want in XInc, out YInc, result in %s, out %s", in, out)
 	}
 }
@@ -25,13 +26,13 @@ func TestSubRoute_InOutDirection_Oblique(t *testing.T) {
 	sr := SubRoute{
 		Type:      Oblique,
 		MoveType:  26,
-		Start:     Point{157450.000000, 22600.000000},
-		End:       Point{154950.000000, 21400.000000},
+		Start:     util.IntPoint{X: 157450, Y: 22600},
+		End:       util.IntPoint{X: 154950, Y: 21400},
 		RefParams: [6]int32{1200, 0, 0, 0, 0, 0},
 	}
 
 	in, out := sr.InOutDirection()
-	if in != XDec || out != YDec {
+	if in != util.XDec || out != util.YDec {
 		t.Errorf("want in XDec, out YDec, result in %s, out %s", in, out)
 	}
 }
@@ -40,9 +41,48 @@ func TestSubRoute_String(t *testing.T) {
 	sr := SubRoute{
 		Type:      Oblique,
 		MoveType:  26,
-		Start:     Point{157450.000000, 22600.000000},
-		End:       Point{154950.000000, 21400.000000},
+		Start:     util.IntPoint{X: 157450, Y: 22600},
+		End:       util.IntPoint{X: 154950, Y: 21400},
 		RefParams: [6]int32{1200, 0, 0, 0, 0, 0},
 	}
 	log.Print(sr)
 }
+
+func TestSubRoute_InOutDirection_Straight(t *testing.T) {
+	sr := SubRoute{
+		Type:  Straight,
+		Start: util.IntPoint{X: 10000, Y: 22600},
+		End:   util.IntPoint{X: 20000, Y: 22600},
+	}
+
+	in, out := sr.InOutDirection()
+	if in != util.XInc || out != util.XInc {
+		t.Errorf("want in XInc, out XInc, result in %s, out %s", in, out)
+	}
+}
+
+func TestSubRoute_MaxCurvature(t *testing.T) {
+	u := SubRoute{
+		Type:      UTurn,
+		Start:     util.IntPoint{X: 0, Y: 0},
+		End:       util.IntPoint{X: 0, Y: 2000},
+		RefPoints: [2]util.IntPoint{{X: 1000, Y: 0}, {X: 1000, Y: 2000}},
+	}
+	if k, err := u.MaxCurvature(); err != nil || !util.FloatEqual(k, 0.001) {
+		t.Errorf("want UTurn radius 1000, result %f %v", k, err)
+	}
+
+	s := SubRoute{
+		Type:      STurn,
+		Start:     util.IntPoint{X: 0, Y: 0},
+		End:       util.IntPoint{X: 5000, Y: 1000},
+		RefPoints: [2]util.IntPoint{{X: 1000, Y: 0}, {X: 4000, Y: 1000}},
+	}
+	if k, err := s.MaxCurvature(); err != nil || !util.FloatEqual(k, 6.0*1000/(3000*3000)) {
+		t.Errorf("want STurn bend 6*1000/3000^2, result %f %v", k, err)
+	}
+
+	if _, err := (SubRoute{Type: Straight}).MaxCurvature(); err == nil {
+		t.Error("want error for straight")
+	}
+}
@@ -0,0 +1,346 @@
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"traffic"
+	"traffic/forbidden"
+	"traffic/legume"
+	"traffic/route"
+	"traffic/simulator"
+	"traffic/util"
+	"traffic/vehicle"
+)
+
+const (
+	gDefaultStep     = 0.1
+	gDefaultDuration = 600
+)
+
+type Vehicle struct {
+	ID, Priority int
+	Start        util.IntPoint
+	Heading      util.Degree
+	Model        string
+}
+
+type Mission struct {
+	ID     int
+	At     float64
+	Routes []route.SubRoute
+}
+
+type Area struct {
+	ID, Type, RelateID int
+	Min, Max           util.IntPoint
+}
+
+type Expect struct {
+	NoCollision, NoDeadlock bool
+	ArriveWithin            float64
+}
+
+type Scenario struct {
+	Name           string
+	Step, Duration float64
+	Bounds         [2]util.IntPoint
+	Models         []vehicle.Model
+	Fleet          []Vehicle
+	Missions       []Mission
+	Forbidden      []Area
+	Expect         Expect
+}
+
+type Collision struct {
+	At   float64
+	ID1  int
+	ID2  int
+	Pos1 util.IntPoint
+	Pos2 util.IntPoint
+}
+
+type Result struct {
+	Elapsed    float64
+	Arrival    map[int]float64
+	Collisions []Collision
+	Deadlocks  [][]int
+	OutOfMap   []int
+}
+
+func (s Scenario) String() string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func (s *Scenario) LoadFromJSONFile(fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(data, s); err != nil {
+		return err
+	}
+
+	return s.validate()
+}
+
+func (s *Scenario) validate() error {
+	if s.Step <= 0 {
+		s.Step = gDefaultStep
+	}
+	if s.Duration <= 0 {
+		s.Duration = gDefaultDuration
+	}
+
+	models := make(map[string]bool)
+	for _, m := range s.Models {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("Scenario %s: %s", s.Name, err)
+		}
+		models[m.Name] = true
+	}
+
+	ids := make(map[int]bool)
+	for _, v := range s.Fleet {
+		if ids[v.ID] {
+			return fmt.Errorf("Scenario %s: duplicate AGV %d", s.Name, v.ID)
+		}
+		if v.Model != "" && !models[v.Model] {
+			return fmt.Errorf("Scenario %s: AGV %d with unknown model %s", s.Name, v.ID, v.Model)
+		}
+		ids[v.ID] = true
+	}
+
+	for i, m := range s.Missions {
+		if !ids[m.ID] {
+			return fmt.Errorf("Scenario %s: mission %d for unknown AGV %d", s.Name, i, m.ID)
+		}
+		if len(m.Routes) == 0 {
+			return fmt.Errorf("Scenario %s: mission %d has no routes", s.Name, i)
+		}
+	}
+
+	return nil
+}
+
+func (s Scenario) isInBounds(p util.IntPoint) bool {
+	min, max := s.Bounds[0], s.Bounds[1]
+	if min.Equal(max) {
+		return true
+	}
+	return p.X >= min.X && p.X <= max.X && p.Y >= min.Y && p.Y <= max.Y
+}
+
+func (s Scenario) Run() (r Result, err error) {
+	log.Printf("<Scenario.Run> %s, %d AGV, %d missions\n", s.Name, len(s.Fleet), len(s.Missions))
+	defer log.Println("<Scenario.Run> exit")
+
+	if err = s.validate(); err != nil {
+		return r, err
+	}
+
+	for _, a := range s.Forbidden {
+		forbidden.Add(a.ID, a.Type, a.RelateID, a.Min, a.Max)
+		defer forbidden.Delete(a.ID)
+	}
+
+	c := traffic.NewController()
+	sims := make(map[int]*simulator.Vehicle)
+	for _, v := range s.Fleet {
+		m := s.model(v.Model)
+		c.RegisterModel(v.ID, m)
+		sims[v.ID] = simulator.New(v.ID, v.Start, v.Heading)
+		sims[v.ID].Priority = v.Priority
+		sims[v.ID].Model = m
+	}
+
+	missions := append([]Mission(nil), s.Missions...)
+	sort.SliceStable(missions, func(i, j int) bool { return missions[i].At < missions[j].At })
+
+	r.Arrival = make(map[int]float64)
+	running := make(map[int]bool)
+	colliding := make(map[[2]int]bool)
+	deadlocked := false
+	outOfMap := make(map[int]bool)
+	step := time.Duration(s.Step * float64(time.Second))
+	clock := time.Now()
+	c.SetClock(func() time.Time { return clock })
+
+	for i := 0; float64(i)*s.Step <= s.Duration; i++ {
+		now := float64(i) * s.Step
+		r.Elapsed = now
+		if i > 0 {
+			clock = clock.Add(step)
+		}
+
+		for len(missions) > 0 && missions[0].At <= now && !running[missions[0].ID] {
+			m := missions[0]
+			missions = missions[1:]
+			if err = sims[m.ID].SetRoutes(m.Routes); err != nil {
+				return r, fmt.Errorf("Scenario %s: AGV %d: %s", s.Name, m.ID, err)
+			}
+			if !c.SetRoutes(m.ID, m.Routes) {
+				return r, fmt.Errorf("Scenario %s: AGV %d can't set routes", s.Name, m.ID)
+			}
+			delete(r.Arrival, m.ID)
+			running[m.ID] = true
+		}
+
+		statuses := make([]traffic.AGVStatus, 0, len(s.Fleet))
+		for _, v := range s.Fleet {
+			statuses = append(statuses, sims[v.ID].Status())
+		}
+
+		for _, res := range c.Update(statuses) {
+			if res.RunStatus == traffic.Fault {
+				return r, fmt.Errorf("Scenario %s: AGV %d fault, error code %d", s.Name, res.ID, res.ErrorCode)
+			}
+
+			if running[res.ID] && res.RunStatus != traffic.Run {
+				running[res.ID] = false
+				r.Arrival[res.ID] = now
+				continue
+			}
+
+			if running[res.ID] {
+				for _, cmd := range res.Commands {
+					sims[res.ID].Execute(cmd)
+				}
+			}
+		}
+
+		if ds := c.Deadlocks(); len(ds) > 0 && !deadlocked {
+			for _, d := range ds {
+				r.Deadlocks = append(r.Deadlocks, d.IDs)
+			}
+		}
+		deadlocked = len(c.Deadlocks()) > 0
+
+		for _, v := range s.Fleet {
+			sims[v.ID].Step(step)
+		}
+
+		r.Collisions = append(r.Collisions, s.collisions(now, sims, colliding)...)
+		for _, v := range s.Fleet {
+			if !outOfMap[v.ID] && !s.isInBounds(sims[v.ID].Position.ToIntPoint()) {
+				outOfMap[v.ID] = true
+				r.OutOfMap = append(r.OutOfMap, v.ID)
+			}
+		}
+
+		if len(missions) == 0 && !isAnyRunning(running) {
+			break
+		}
+	}
+
+	return r, nil
+}
+
+func isAnyRunning(running map[int]bool) bool {
+	for _, r := range running {
+		if r {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scenario) model(name string) *vehicle.Model {
+	for i := range s.Models {
+		if s.Models[i].Name == name {
+			return &s.Models[i]
+		}
+	}
+	return &vehicle.Default
+}
+
+func body(v *simulator.Vehicle) legume.OBB {
+	m := v.Model
+	if m == nil {
+		m = &vehicle.Default
+	}
+	return legume.CreateOBB(v.Position, m.HalfLength, m.HalfWidth, v.Heading)
+}
+
+func (s Scenario) collisions(now float64, sims map[int]*simulator.Vehicle, colliding map[[2]int]bool) (cs []Collision) {
+	for i, a := range s.Fleet {
+		for _, b := range s.Fleet[i+1:] {
+			key := [2]int{a.ID, b.ID}
+			va, vb := sims[a.ID], sims[b.ID]
+			isOverlap := body(va).IsOverlap(body(vb))
+			if isOverlap && !colliding[key] {
+				cs = append(cs, Collision{At: now, ID1: a.ID, ID2: b.ID, Pos1: va.Position.ToIntPoint(), Pos2: vb.Position.ToIntPoint()})
+			}
+			colliding[key] = isOverlap
+		}
+	}
+	return cs
+}
+
+func (s Scenario) Verify(r Result) error {
+	var errs []string
+
+	if s.Expect.NoCollision {
+		for _, c := range r.Collisions {
+			errs = append(errs, fmt.Sprintf("AGV %d collide with AGV %d at %.1fs, (%d, %d) (%d, %d)",
+				c.ID1, c.ID2, c.At, c.Pos1.X, c.Pos1.Y, c.Pos2.X, c.Pos2.Y))
+		}
+	}
+
+	if s.Expect.NoDeadlock {
+		for _, d := range r.Deadlocks {
+			errs = append(errs, fmt.Sprintf("deadlock AGV %v", d))
+		}
+	}
+
+	if s.Expect.ArriveWithin > 0 {
+		for _, m := range s.Missions {
+			at, ok := r.Arrival[m.ID]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("AGV %d not arrived in %.1fs", m.ID, r.Elapsed))
+			} else if at > s.Expect.ArriveWithin {
+				errs = append(errs, fmt.Sprintf("AGV %d arrived at %.1fs, later than %.1fs", m.ID, at, s.Expect.ArriveWithin))
+			}
+		}
+	}
+
+	for _, id := range r.OutOfMap {
+		errs = append(errs, fmt.Sprintf("AGV %d out of map", id))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("Scenario %s: %s", s.Name, strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func RunFile(fileName string) error {
+	var s Scenario
+	if err := s.LoadFromJSONFile(fileName); err != nil {
+		return err
+	}
+
+	r, err := s.Run()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("<scenario.RunFile> %s elapsed %.1fs, arrival %v\n", s.Name, r.Elapsed, r.Arrival)
+	return s.Verify(r)
+}
@@ -0,0 +1,57 @@
+package scenario
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRunFile_Crossing(t *testing.T) {
+	if err := RunFile("data/crossing.json"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScenario_Forbidden(t *testing.T) {
+	var s Scenario
+	if err := s.LoadFromJSONFile("data/forbidden.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := r.Arrival[1]; ok {
+		t.Errorf("want AGV 1 blocked by forbidden area, arrival %v", r.Arrival)
+	}
+	if s.Verify(r) == nil {
+		t.Error("want verify failed for AGV 1 not arrived")
+	}
+}
+
+func TestScenario_Validate(t *testing.T) {
+	s := Scenario{Name: "invalid", Fleet: []Vehicle{{ID: 1}, {ID: 1}}}
+	if _, err := s.Run(); err == nil {
+		t.Error("want error for duplicate AGV")
+	}
+}
+
+func TestScenario_Linkage(t *testing.T) {
+	var s Scenario
+	if err := s.LoadFromJSONFile("data/linkage.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Verify(r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Arrival[1] < 2 || math.Abs(r.Arrival[1]-r.Arrival[2]) > s.Step {
+		t.Errorf("want linked AGV arrive together after partner ready, arrival %v", r.Arrival)
+	}
+}
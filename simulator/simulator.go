@@ -0,0 +1,202 @@
+package simulator
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+	"traffic"
+	"traffic/path"
+	"traffic/route"
+	"traffic/util"
+	"traffic/vehicle"
+)
+
+const (
+	gArrivalDistance  = 0.5
+	gHeadingTolerance = 1
+)
+
+type segment struct {
+	index, motionStatus int
+	s0, s1              float64
+}
+
+type Vehicle struct {
+	ID, Priority, ControlCode int
+	Position                  util.FloatPoint
+	Heading                   util.Degree
+	Speed                     float64
+	MotionStatus              int
+	Model                     *vehicle.Model
+
+	routes      []route.SubRoute
+	path        *path.Path
+	segments    []segment
+	s, target   float64
+	targetIndex int
+	command     traffic.AGVCommand
+	profile     route.Profile
+}
+
+func New(id int, p util.IntPoint, heading util.Degree) *Vehicle {
+	return &Vehicle{ID: id, Position: p.ToFloatPoint(), Heading: heading, MotionStatus: traffic.MSStop}
+}
+
+// SetRoutes takes routes starting where the vehicle stands, within the
+// arrival tolerance of its model and facing the heading of the first pose.
+func (v *Vehicle) SetRoutes(routes []route.SubRoute) error {
+	v.routes = nil
+	v.path = nil
+	v.segments = nil
+	v.s = 0
+	v.target = 0
+	v.targetIndex = 0
+
+	m := v.model()
+	p, err := path.OfSubRoutes(routes, m.Wheelbase)
+	if err != nil {
+		return err
+	}
+	if len(p.Poses) > 0 {
+		start := p.Poses[0]
+		if d := v.Position.Distance(start.FloatPoint); d > math.Max(m.ToleranceParallel, m.ToleranceVertical) {
+			return fmt.Errorf("AGV %d at %v is %.1f away from the route start %v", v.ID, v.Position, d, start.FloatPoint)
+		}
+		if diff := math.Abs(math.Remainder(float64(v.Heading-start.Deg), 360)); diff > gHeadingTolerance {
+			return fmt.Errorf("AGV %d heading %.1f, the route starts heading %.1f", v.ID, v.Heading, start.Deg)
+		}
+	}
+
+	for i, sr := range routes {
+		v.segments = append(v.segments, segment{index: i, motionStatus: motionStatusOf(sr.Type), s0: p.Bounds[i], s1: p.Bounds[i+1]})
+	}
+
+	v.routes = routes
+	v.path = p
+	return nil
+}
+
+// Execute drives to the end of the sub route the command encodes, a command
+// whose type or refs differ from the sub route at its target is rejected.
+func (v *Vehicle) Execute(cmd traffic.AGVCommand) bool {
+	for _, seg := range v.segments {
+		sr := v.routes[seg.index]
+		if seg.s1 < v.s || !sr.End.Equal(cmd.Target) {
+			continue
+		}
+		if want, err := traffic.EncodeCommand(sr); err != nil || want.Type != cmd.Type || want.CommandRefs != cmd.CommandRefs {
+			log.Printf("<Vehicle.Execute> AGV %d command type %d refs %v doesn't match sub route %d %s\n", v.ID, cmd.Type, cmd.CommandRefs, seg.index, sr)
+			continue
+		}
+
+		v.command = cmd
+		v.ControlCode = cmd.Seq
+		v.target = seg.s1
+		v.targetIndex = seg.index + 1
+		v.profile = v.profileTo(v.targetIndex)
+		return true
+	}
+
+	log.Printf("<Vehicle.Execute> AGV %d can't find target (%d, %d) on routes\n", v.ID, cmd.Target.X, cmd.Target.Y)
+	return false
+}
+
+func (v *Vehicle) Step(dt time.Duration) {
+	sec := dt.Seconds()
+	remaining := v.target - v.s
+	if remaining <= gArrivalDistance {
+		v.s = math.Max(v.s, v.target)
+		v.Speed = 0
+		v.MotionStatus = traffic.MSStop
+		return
+	}
+
+	seg := v.segmentAt(v.s)
+	acc, dec := v.routes[seg.index].Acceleration()
+	desired := v.profile.SpeedLimitAt(v.s)
+
+	if v.Speed < desired {
+		v.Speed = math.Min(desired, v.Speed+acc*sec)
+	} else {
+		v.Speed = math.Max(desired, v.Speed-dec*sec)
+	}
+
+	ds := v.Speed * sec
+	if ds >= remaining {
+		v.s = v.target
+		v.Speed = 0
+	} else {
+		v.s += ds
+	}
+
+	p := v.path.At(v.s)
+	v.Position = p.FloatPoint
+	v.Heading = p.Deg
+	if v.Speed == 0 {
+		v.MotionStatus = traffic.MSStop
+	} else {
+		v.MotionStatus = v.segmentAt(v.s).motionStatus
+	}
+}
+
+func (v *Vehicle) Status() traffic.AGVStatus {
+	return traffic.AGVStatus{
+		ID:           v.ID,
+		Heading:      int(math.Round(float64(v.Heading.Normalize()))) % 360,
+		Speed:        int(v.Speed),
+		MotionStatus: v.MotionStatus,
+		Priority:     v.Priority,
+		Pos:          v.Position.ToIntPoint(),
+		ControlCode:  v.ControlCode,
+		Target:       route.Mark{Index: v.targetIndex, Position: v.command.Target},
+	}
+}
+
+func (v *Vehicle) IsArrived() bool {
+	return len(v.segments) > 0 && v.s >= v.segments[len(v.segments)-1].s1-gArrivalDistance
+}
+
+func (v *Vehicle) model() *vehicle.Model {
+	if v.Model == nil {
+		return &vehicle.Default
+	}
+	return v.Model
+}
+
+func (v *Vehicle) profileTo(targetIndex int) route.Profile {
+	m := v.model()
+	srs := make([]route.SubRoute, targetIndex)
+	lengths := make([]float64, targetIndex)
+	for i := range lengths {
+		srs[i] = m.Limit(v.routes[i])
+		lengths[i] = v.segments[i].s1 - v.segments[i].s0
+	}
+	return route.NewProfileOfLength(srs, lengths, 0, v.command.MaxStraightSpeed, v.command.MaxSpecialSpeed)
+}
+
+func motionStatusOf(t int) int {
+	switch t {
+	case route.Straight, route.Linkage:
+		return traffic.MSStraight
+	case route.QTurn:
+		return traffic.MSQTurn
+	case route.Oblique:
+		return traffic.MSOblique
+	case route.UTurn:
+		return traffic.MSUTurn
+	case route.STurn:
+		return traffic.MSSTurn
+	default:
+		return traffic.MSUncertain
+	}
+}
+
+func (v *Vehicle) segmentAt(s float64) segment {
+	i := sort.Search(len(v.segments), func(i int) bool { return v.segments[i].s1 > s })
+	if i == len(v.segments) {
+		i--
+	}
+	return v.segments[i]
+}
@@ -0,0 +1,140 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+	"traffic"
+	"traffic/route"
+	"traffic/util"
+)
+
+func run(t *testing.T, v *Vehicle, cmd traffic.AGVCommand) (statuses []traffic.AGVStatus) {
+	if !v.Execute(cmd) {
+		t.Fatalf("execute command %v failed", cmd)
+	}
+
+	for i := 0; i < 10000; i++ {
+		v.Step(100 * time.Millisecond)
+		statuses = append(statuses, v.Status())
+		if i > 0 && v.MotionStatus == traffic.MSStop {
+			break
+		}
+	}
+	return statuses
+}
+
+func TestVehicle_Straight(t *testing.T) {
+	end := util.IntPoint{X: 10000, Y: 0}
+	v := New(1, util.IntPoint{X: 0, Y: 0}, 0)
+	if err := v.SetRoutes([]route.SubRoute{{Type: route.Straight, Start: util.IntPoint{X: 0, Y: 0}, End: end, MaxSpeed: 1500}}); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := run(t, v, traffic.AGVCommand{Type: route.Straight, Target: end, MaxStraightSpeed: 2000})
+	last := statuses[len(statuses)-1]
+	if !last.Pos.Equal(end) || last.Heading != 0 || !v.IsArrived() {
+		t.Errorf("want stop at %v heading 0, result %s", end, last)
+	}
+
+	for _, s := range statuses[:len(statuses)-1] {
+		if s.MotionStatus != traffic.MSStraight || s.Speed > 1500 {
+			t.Errorf("want straight under 1500, result %s", s)
+		}
+	}
+}
+
+func TestVehicle_Astern(t *testing.T) {
+	end := util.IntPoint{X: 0, Y: 0}
+	v := New(1, util.IntPoint{X: 5000, Y: 0}, 0)
+	if err := v.SetRoutes([]route.SubRoute{{Type: route.Straight, Start: util.IntPoint{X: 5000, Y: 0}, End: end, IsAstern: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := run(t, v, traffic.AGVCommand{Type: route.Straight, Heading: 0, Target: end})
+	for _, s := range statuses {
+		if s.Heading != 0 {
+			t.Fatalf("want astern keep heading 0, result %s", s)
+		}
+	}
+	if last := statuses[len(statuses)-1]; !last.Pos.Equal(end) {
+		t.Errorf("want back to %v, result %s", end, last)
+	}
+}
+
+func TestVehicle_QTurn(t *testing.T) {
+	sr := route.SubRoute{
+		Type:      route.QTurn,
+		MoveType:  10,
+		Start:     util.IntPoint{X: 199050, Y: 22600},
+		End:       util.IntPoint{X: 200350, Y: 24000},
+		RefParams: [6]int32{400, 700, 1300, 0, 0, 0},
+		RefPoints: [2]util.IntPoint{{X: 200350, Y: 22600}, {}},
+	}
+
+	v := New(1, sr.Start, 0)
+	if err := v.SetRoutes([]route.SubRoute{sr}); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := traffic.EncodeCommand(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd.MaxSpecialSpeed = 500
+	statuses := run(t, v, cmd)
+	last := statuses[len(statuses)-1]
+	if !last.Pos.Equal(sr.End) || last.Heading != 90 {
+		t.Errorf("want stop at %v heading 90, result %s", sr.End, last)
+	}
+	if statuses[len(statuses)/2].MotionStatus != traffic.MSQTurn {
+		t.Errorf("want QTurn motion status, result %s", statuses[len(statuses)/2])
+	}
+}
+
+func TestVehicle_ExecuteUnknownTarget(t *testing.T) {
+	v := New(1, util.IntPoint{X: 0, Y: 0}, 0)
+	v.SetRoutes([]route.SubRoute{{Type: route.Straight, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 10000, Y: 0}}})
+	if v.Execute(traffic.AGVCommand{Target: util.IntPoint{X: 5000, Y: 0}}) {
+		t.Error("want execute failed for target off routes")
+	}
+}
+
+func TestVehicle_ExecuteMismatch(t *testing.T) {
+	sr := route.SubRoute{Type: route.Oblique, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 5000, Y: 1200},
+		RefParams: [6]int32{1200, 0, 0, 0, 0, 0}}
+	v := New(1, sr.Start, 0)
+	if err := v.SetRoutes([]route.SubRoute{sr}); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := traffic.EncodeCommand(sr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Execute(traffic.AGVCommand{Type: route.Straight, Target: sr.End}) {
+		t.Error("want execute failed for straight command on oblique sub route")
+	}
+	wrong := cmd
+	wrong.CommandRefs[traffic.CRRef1] = 600
+	if v.Execute(wrong) {
+		t.Error("want execute failed for lateral offset other than the sub route")
+	}
+	if !v.Execute(cmd) {
+		t.Errorf("want execute %v", cmd)
+	}
+}
+
+func TestVehicle_SetRoutesStart(t *testing.T) {
+	srs := []route.SubRoute{{Type: route.Straight, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 10000, Y: 0}}}
+	if err := New(1, util.IntPoint{X: 3, Y: 5}, 0).SetRoutes(srs); err != nil {
+		t.Errorf("want start within tolerance taken, result %s", err)
+	}
+
+	v := New(1, util.IntPoint{X: 2000, Y: 0}, 0)
+	if err := v.SetRoutes(srs); err == nil || !v.Position.Equal(util.FloatPoint{X: 2000, Y: 0}) {
+		t.Errorf("want start off the vehicle refused in place, result %v at %v", err, v.Position)
+	}
+	if err := New(1, util.IntPoint{X: 0, Y: 0}, 90).SetRoutes(srs); err == nil {
+		t.Error("want start heading off the vehicle refused")
+	}
+}
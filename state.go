@@ -0,0 +1,152 @@
+package traffic
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+const gHistorySize = 32
+
+var gRunStatusNames = map[int]string{
+	Undefined: "Undefined",
+	Idle:      "Idle",
+	Run:       "Run",
+	Fault:     "Fault",
+	Pause:     "Pause",
+	Manual:    "Manual",
+}
+
+var gRunTransitions = map[int][]int{
+	Undefined: {Idle},
+	Idle:      {Run, Fault, Manual},
+	Run:       {Idle, Pause, Fault, Manual},
+	Pause:     {Run, Idle, Fault, Manual},
+	Fault:     {Idle, Manual},
+	Manual:    {Idle, Fault},
+}
+
+var gRunGuards = map[int]func(v *AGV) error{
+	Run: func(v *AGV) error {
+		if len(v.Routes) == 0 {
+			return fmt.Errorf("no routes")
+		}
+		if v.Current.Index >= len(v.Routes) {
+			return fmt.Errorf("already at the end of routes")
+		}
+		return nil
+	},
+}
+
+type Transition struct {
+	From, To int
+	Reason   string
+	At       time.Time
+}
+
+func (t Transition) String() string {
+	return fmt.Sprintf("%s -> %s (%s)", RunStatusName(t.From), RunStatusName(t.To), t.Reason)
+}
+
+type StateHook func(v *AGV, t Transition)
+
+type stateHooks struct {
+	enter, exit map[int][]StateHook
+}
+
+func newStateHooks() *stateHooks {
+	return &stateHooks{enter: make(map[int][]StateHook), exit: make(map[int][]StateHook)}
+}
+
+func RunStatusName(status int) string {
+	if name, ok := gRunStatusNames[status]; ok {
+		return name
+	}
+	return fmt.Sprintf("RunStatus(%d)", status)
+}
+
+func IsLegalTransition(from, to int) bool {
+	for _, s := range gRunTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (v *AGV) Transit(to int, reason string) error {
+	from := v.RunStatus
+	if from == to {
+		return nil
+	}
+	if !IsLegalTransition(from, to) {
+		return fmt.Errorf("AGV %d illegal transition %s -> %s", v.ID, RunStatusName(from), RunStatusName(to))
+	}
+	if guard, ok := gRunGuards[to]; ok {
+		if err := guard(v); err != nil {
+			return fmt.Errorf("AGV %d can't %s: %s", v.ID, RunStatusName(to), err)
+		}
+	}
+
+	t := Transition{From: from, To: to, Reason: reason, At: time.Now()}
+	log.Printf("<AGV.Transit> AGV %d %s\n", v.ID, t)
+
+	if v.hooks != nil {
+		for _, h := range v.hooks.exit[from] {
+			h(v, t)
+		}
+	}
+
+	v.RunStatus = to
+	if from == Fault {
+		v.ErrorCode = ECNone
+	}
+	v.history = append(v.history, t)
+	if len(v.history) > gHistorySize {
+		v.history = v.history[len(v.history)-gHistorySize:]
+	}
+
+	if v.hooks != nil {
+		for _, h := range v.hooks.enter[to] {
+			h(v, t)
+		}
+	}
+	return nil
+}
+
+func (v *AGV) fault(code int, reason string) {
+	v.ErrorCode = code
+	if err := v.Transit(Fault, reason); err != nil {
+		log.Printf("<AGV.fault> %s\n", err)
+	}
+}
+
+func (v *AGV) History() []Transition {
+	return append([]Transition(nil), v.history...)
+}
+
+func (c *Controller) OnEnter(id, status int, h StateHook) error {
+	v, ok := c.agvs[id]
+	if !ok {
+		return fmt.Errorf("Can't find AGV %d", id)
+	}
+	v.hooks.enter[status] = append(v.hooks.enter[status], h)
+	return nil
+}
+
+func (c *Controller) OnExit(id, status int, h StateHook) error {
+	v, ok := c.agvs[id]
+	if !ok {
+		return fmt.Errorf("Can't find AGV %d", id)
+	}
+	v.hooks.exit[status] = append(v.hooks.exit[status], h)
+	return nil
+}
+
+func (c *Controller) SetRunStatus(id, status int, reason string) error {
+	v, ok := c.agvs[id]
+	if !ok {
+		return fmt.Errorf("Can't find AGV %d", id)
+	}
+	return v.Transit(status, reason)
+}
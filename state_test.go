@@ -0,0 +1,81 @@
+package traffic
+
+import (
+	"testing"
+	"traffic/util"
+)
+
+func TestAGV_Transit(t *testing.T) {
+	c := NewController()
+	c.Register(1)
+	v, _ := c.AGV(1)
+
+	if err := v.Transit(Run, "test"); err == nil {
+		t.Error("want run without routes refused")
+	}
+	if err := v.Transit(Pause, "test"); err == nil || v.RunStatus != Idle {
+		t.Errorf("want idle to pause illegal, status %s", RunStatusName(v.RunStatus))
+	}
+
+	c.SetRoutes(1, straightRoutes(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 10000, Y: 0}))
+	if err := c.SetRunStatus(1, Pause, "operator"); err != nil || v.RunStatus != Pause {
+		t.Errorf("want paused, err %v, status %s", err, RunStatusName(v.RunStatus))
+	}
+	if c.SetRoutes(1, nil) {
+		t.Error("want set routes refused while paused")
+	}
+	if err := c.SetRunStatus(1, Run, "operator"); err != nil {
+		t.Error(err)
+	}
+
+	h := v.History()
+	want := []int{Idle, Run, Pause, Run}
+	if len(h) != len(want) {
+		t.Fatalf("want %d transitions, result %v", len(want), h)
+	}
+	for i, s := range want {
+		if h[i].To != s {
+			t.Errorf("want transition %d to %s, result %s", i, RunStatusName(s), h[i])
+		}
+	}
+}
+
+func TestController_StateHooks(t *testing.T) {
+	c := NewController()
+	c.Register(1)
+	c.Register(2)
+
+	var events []string
+	c.OnExit(1, Run, func(v *AGV, tr Transition) { events = append(events, "exit "+RunStatusName(tr.From)) })
+	c.OnEnter(1, Fault, func(v *AGV, tr Transition) {
+		events = append(events, "enter "+RunStatusName(tr.To))
+		if v.ErrorCode != ECNoAck {
+			t.Errorf("want error code set before enter, result %d", v.ErrorCode)
+		}
+	})
+	if err := c.OnEnter(3, Fault, func(v *AGV, tr Transition) {}); err == nil {
+		t.Error("want hook on unknown AGV refused")
+	}
+
+	routes := straightRoutes(util.IntPoint{X: 0, Y: 0}, util.IntPoint{X: 10000, Y: 0})
+	c.SetRoutes(1, routes)
+	c.SetRoutes(2, routes)
+	v, _ := c.AGV(1)
+	q, _ := c.AGV(2)
+	q.fault(ECNoAck, "test")
+	v.fault(ECNoAck, "test")
+
+	if len(events) != 2 || events[0] != "exit Run" || events[1] != "enter Fault" {
+		t.Errorf("want exit run then enter fault of AGV 1 only, result %v", events)
+	}
+
+	if c.SetRoutes(1, routes) || v.RunStatus != Fault || v.ErrorCode != ECNoAck {
+		t.Errorf("want set routes refused while fault, status %s", RunStatusName(v.RunStatus))
+	}
+	if err := c.SetRunStatus(1, Idle, "clear"); err != nil || v.ErrorCode != ECNone {
+		t.Errorf("want fault cleared, err %v, error code %d", err, v.ErrorCode)
+	}
+	if !c.SetRoutes(1, routes) {
+		t.Error("want set routes after fault cleared")
+	}
+}
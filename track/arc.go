@@ -0,0 +1,244 @@
+package track
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"traffic/util"
+)
+
+const (
+	gArcStep      = 1
+	gArcRounds    = 32
+	gArcPrecision = 1e-6
+	gArcMaxRatio  = 4
+)
+
+// Arc is the arc length parameterization of a Function. The conic is traced
+// from Start to End by stepping along the tangent and projecting back onto the
+// curve, the walk is bounded by the chord length so a segment that never
+// reaches End fails instead of looping.
+type Arc struct {
+	f      Function
+	s      []float64
+	points []util.FloatPoint
+}
+
+type ArcPoint struct {
+	util.FloatPoint
+	S         float64
+	Index     int
+	Tangent   util.Degree
+	Curvature float64
+}
+
+func (f Function) isLine() bool {
+	return f.P[0] == 0 && f.P[1] == 0 && f.P[2] == 0
+}
+
+func (f Function) project(p util.FloatPoint) (util.FloatPoint, error) {
+	for i := 0; i < gArcRounds; i++ {
+		gx, gy := f.gradient(p)
+		n := gx*gx + gy*gy
+		if n == 0 {
+			return p, fmt.Errorf("Degenerate gradient at %v", p)
+		}
+		v := f.Evaluate(p)
+		p = util.FloatPoint{X: p.X - v*gx/n, Y: p.Y - v*gy/n}
+		if math.Abs(v)/math.Sqrt(n) < gArcPrecision {
+			return p, nil
+		}
+	}
+	return p, fmt.Errorf("Projection of %v does not converge", p)
+}
+
+// direction returns the unit tangent at p, oriented along ref.
+func (f Function) direction(p util.FloatPoint, refX, refY float64) (tx, ty float64) {
+	gx, gy := f.gradient(p)
+	n := math.Hypot(gx, gy)
+	tx, ty = -gy/n, gx/n
+	if tx*refX+ty*refY < 0 {
+		tx, ty = -tx, -ty
+	}
+	return tx, ty
+}
+
+// Arc traces the segment. The direction of travel at Start is the tangent
+// closer to the chord, so a single segment may not turn more than 180 degrees.
+func (f Function) Arc() (a Arc, err error) {
+	a.f = f
+	chord := f.Start.Distance(f.End)
+	if chord == 0 {
+		return a, fmt.Errorf("Start and end are both %v", f.Start)
+	}
+	if f.isLine() {
+		a.s = []float64{0, chord}
+		a.points = []util.FloatPoint{f.Start, f.End}
+		return a, nil
+	}
+
+	if ok, err := f.Verify(); !ok {
+		return a, err
+	}
+	p, err := f.project(f.Start)
+	if err != nil {
+		return a, err
+	}
+	end, err := f.project(f.End)
+	if err != nil {
+		return a, err
+	}
+
+	tx, ty := f.direction(p, end.X-p.X, end.Y-p.Y)
+	a.s = []float64{0}
+	a.points = []util.FloatPoint{p}
+	for n := math.Ceil(gArcMaxRatio*chord/gArcStep) + 16; n > 0; n-- {
+		if d := p.Distance(end); d <= gArcStep {
+			a.s = append(a.s, a.Length()+d)
+			a.points = append(a.points, end)
+			return a, nil
+		}
+
+		q, err := f.project(util.FloatPoint{X: p.X + gArcStep*tx, Y: p.Y + gArcStep*ty})
+		if err != nil {
+			return a, err
+		}
+		tx, ty = f.direction(q, tx, ty)
+		a.s = append(a.s, a.Length()+p.Distance(q))
+		a.points = append(a.points, q)
+		p = q
+	}
+	return a, fmt.Errorf("Can't reach end %v from start %v, stopped at %v", f.End, f.Start, p)
+}
+
+func (a Arc) Length() float64 {
+	if len(a.s) == 0 {
+		return 0
+	}
+	return a.s[len(a.s)-1]
+}
+
+func (a Arc) at(s float64) (p util.FloatPoint, tx, ty float64, err error) {
+	l := a.Length()
+	if len(a.s) < 2 || s < -gArcPrecision || s > l+gArcPrecision {
+		return p, 0, 0, fmt.Errorf("Arc length %.3f out of range [0, %.3f]", s, l)
+	}
+
+	i := sort.SearchFloat64s(a.s, s)
+	if i == 0 {
+		i = 1
+	} else if i == len(a.s) {
+		i--
+	}
+	u, v := a.points[i-1], a.points[i]
+	k := math.Max(0, math.Min(1, (s-a.s[i-1])/(a.s[i]-a.s[i-1])))
+	p = util.FloatPoint{X: u.X + k*(v.X-u.X), Y: u.Y + k*(v.Y-u.Y)}
+	if a.f.isLine() {
+		d := a.s[i] - a.s[i-1]
+		return p, (v.X - u.X) / d, (v.Y - u.Y) / d, nil
+	}
+
+	if p, err = a.f.project(p); err != nil {
+		return p, 0, 0, err
+	}
+	tx, ty = a.f.direction(p, v.X-u.X, v.Y-u.Y)
+	return p, tx, ty, nil
+}
+
+func (a Arc) PointAt(s float64) (util.FloatPoint, error) {
+	p, _, _, err := a.at(s)
+	return p, err
+}
+
+// TangentAt returns the heading of travel at s.
+func (a Arc) TangentAt(s float64) (util.Degree, error) {
+	_, tx, ty, err := a.at(s)
+	if err != nil {
+		return 0, err
+	}
+	return util.Degree(math.Atan2(ty, tx) * 180 / math.Pi).Normalize(), nil
+}
+
+// CurvatureAt returns the signed curvature at s, positive when turning left.
+func (a Arc) CurvatureAt(s float64) (float64, error) {
+	p, tx, ty, err := a.at(s)
+	if err != nil || a.f.isLine() {
+		return 0, err
+	}
+
+	gx, gy := a.f.gradient(p)
+	fxx, fyy, fxy := 2*a.f.P[0], 2*a.f.P[1], a.f.P[2]
+	k := (gy*gy*fxx - 2*gx*gy*fxy + gx*gx*fyy) / math.Pow(math.Hypot(gx, gy), 3)
+	// k is the curvature along (-gy, gx)
+	if tx*-gy+ty*gx < 0 {
+		k = -k
+	}
+	return k, nil
+}
+
+func Arcs(fs []Function) ([]Arc, error) {
+	arcs := make([]Arc, 0, len(fs))
+	for i, f := range fs {
+		a, err := f.Arc()
+		if err != nil {
+			return nil, fmt.Errorf("Segment %d: %s", i, err)
+		}
+		arcs = append(arcs, a)
+	}
+	return arcs, nil
+}
+
+// EachArcPoint visits points evenly spaced by interval along the joined arcs,
+// the end of the last arc is always visited.
+func EachArcPoint(arcs []Arc, interval float64, visit func(p ArcPoint)) error {
+	if interval <= 0 {
+		return fmt.Errorf("Invalid interval %f", interval)
+	}
+
+	offset, next := 0.0, 0.0
+	for i, a := range arcs {
+		l := a.Length()
+		for ; next <= offset+l+gArcPrecision; next += interval {
+			if err := visitArc(a, i, offset, next-offset, visit); err != nil {
+				return err
+			}
+		}
+		offset += l
+	}
+
+	if len(arcs) > 0 && next-interval < offset-gArcPrecision {
+		last := len(arcs) - 1
+		return visitArc(arcs[last], last, offset-arcs[last].Length(), arcs[last].Length(), visit)
+	}
+	return nil
+}
+
+func visitArc(a Arc, i int, offset, s float64, visit func(p ArcPoint)) error {
+	s = math.Max(0, math.Min(a.Length(), s))
+	p, err := a.PointAt(s)
+	if err != nil {
+		return fmt.Errorf("Segment %d: %s", i, err)
+	}
+	deg, _ := a.TangentAt(s)
+	k, _ := a.CurvatureAt(s)
+	visit(ArcPoint{FloatPoint: p, S: offset + s, Index: i, Tangent: deg, Curvature: k})
+	return nil
+}
+
+// Each visits the front then the rear of the track evenly spaced by interval.
+func (t Track) Each(interval float64, visit func(side string, p ArcPoint)) error {
+	for _, side := range []struct {
+		name string
+		fs   []Function
+	}{{"front", t.Front}, {"rear", t.Rear}} {
+		arcs, err := Arcs(side.fs)
+		if err != nil {
+			return fmt.Errorf("%s: %s", side.name, err)
+		}
+		name := side.name
+		if err := EachArcPoint(arcs, interval, func(p ArcPoint) { visit(name, p) }); err != nil {
+			return fmt.Errorf("%s: %s", side.name, err)
+		}
+	}
+	return nil
+}
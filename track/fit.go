@@ -0,0 +1,448 @@
+package track
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"traffic/util"
+)
+
+const (
+	gMinFitPoints     = 5
+	gMinPointDistance = 0.1
+	gProjectRounds    = 5
+	gJacobiRounds     = 100
+)
+
+type FitSegment struct {
+	Side       string
+	From, To   int
+	IsLine     bool
+	MaxError   float64
+	PointCount int
+}
+
+func (s FitSegment) String() string {
+	kind := "conic"
+	if s.IsLine {
+		kind = "line"
+	}
+	return fmt.Sprintf("%s %d..%d %s, %d points, max error %.3f", s.Side, s.From, s.To, kind, s.PointCount, s.MaxError)
+}
+
+// conic is A x2 + B y2 + C xy + D x + E y + F = 0, same order as Function.P
+type conic [6]float64
+
+func (c conic) evaluate(p util.FloatPoint) float64 {
+	return c[0]*p.X*p.X + c[1]*p.Y*p.Y + c[2]*p.X*p.Y + c[3]*p.X + c[4]*p.Y + c[5]
+}
+
+func (c conic) distance(p util.FloatPoint) float64 {
+	return Function{P: c}.Distance(p)
+}
+
+func (c conic) project(p util.FloatPoint) util.FloatPoint {
+	for i := 0; i < gProjectRounds; i++ {
+		gx, gy := Function{P: c}.gradient(p)
+		n := gx*gx + gy*gy
+		if n == 0 {
+			break
+		}
+		k := c.evaluate(p) / n
+		p = util.FloatPoint{X: p.X - k*gx, Y: p.Y - k*gy}
+	}
+	return p
+}
+
+// toCurve converts the conic to the center, RA, RB and PHI form read by
+// calcEllipseFunc and calcHyperbolaFunc, RA lies along -PHI and a hyperbola
+// is marked by a negative RB.
+func (c conic) toCurve() (q QuadraticCurve, ok bool) {
+	a, b, h := c[0], c[1], c[2]/2
+	det := a*b - h*h
+	if math.Abs(det) < 1e-12*(a*a+b*b+h*h) {
+		return q, false
+	}
+
+	q.CenterPoint = util.FloatPoint{X: (h*c[4] - b*c[3]) / (2 * det), Y: (h*c[3] - a*c[4]) / (2 * det)}
+	f := c[5] + 0.5*(c[3]*q.CenterPoint.X+c[4]*q.CenterPoint.Y)
+	if f == 0 {
+		return q, false
+	}
+
+	// eigen values of [a h; h b] / -f, theta is the direction of l1
+	theta := 0.5 * math.Atan2(2*h, a-b)
+	cos, sin := math.Cos(theta), math.Sin(theta)
+	l1 := (a*cos*cos + 2*h*sin*cos + b*sin*sin) / -f
+	l2 := (a*sin*sin - 2*h*sin*cos + b*cos*cos) / -f
+
+	switch {
+	case l1 > 0 && l2 > 0:
+		q.RA, q.RB = 1/math.Sqrt(l1), 1/math.Sqrt(l2)
+	case l1 > 0 && l2 < 0:
+		q.RA, q.RB = 1/math.Sqrt(l1), -1/math.Sqrt(-l2)
+	case l1 < 0 && l2 > 0:
+		q.RA, q.RB = 1/math.Sqrt(l2), -1/math.Sqrt(-l1)
+		theta += math.Pi / 2
+	default:
+		return q, false
+	}
+	q.PHI = -theta
+	return q, true
+}
+
+type fitModel struct {
+	isLine bool
+	conic  conic
+}
+
+type joint struct {
+	util.FloatPoint
+	tangent    util.FloatPoint
+	hasTangent bool
+}
+
+func (m fitModel) jointAt(p util.FloatPoint) joint {
+	q := m.conic.project(p)
+	gx, gy := Function{P: m.conic}.gradient(q)
+	return joint{FloatPoint: q, tangent: util.FloatPoint{X: -gy, Y: gx}, hasTangent: true}
+}
+
+func fitLine(ps []util.FloatPoint, j joint) (m fitModel) {
+	var nx, ny float64
+	if j.hasTangent {
+		n := math.Hypot(j.tangent.X, j.tangent.Y)
+		nx, ny = -j.tangent.Y/n, j.tangent.X/n
+	} else {
+		var sxx, syy, sxy float64
+		for _, p := range ps {
+			sxx += (p.X - j.X) * (p.X - j.X)
+			syy += (p.Y - j.Y) * (p.Y - j.Y)
+			sxy += (p.X - j.X) * (p.Y - j.Y)
+		}
+		theta := 0.5 * math.Atan2(2*sxy, sxx-syy)
+		nx, ny = -math.Sin(theta), math.Cos(theta)
+	}
+
+	m.isLine = true
+	m.conic = conic{0, 0, 0, nx, ny, -(nx*j.X + ny*j.Y)}
+	return m
+}
+
+// fitConic minimizes the algebraic distance with the conic forced through
+// the joint, and along its tangent if any, so consecutive segments connect
+// smoothly.
+func fitConic(ps []util.FloatPoint, j joint) (m fitModel, ok bool) {
+	var mx, my, s float64
+	for _, p := range ps {
+		mx += p.X
+		my += p.Y
+	}
+	mx /= float64(len(ps))
+	my /= float64(len(ps))
+	for _, p := range ps {
+		s += (p.X-mx)*(p.X-mx) + (p.Y-my)*(p.Y-my)
+	}
+	s = math.Sqrt(s / float64(len(ps)))
+	if s == 0 {
+		return m, false
+	}
+
+	var scatter [6][6]float64
+	trace := 0.0
+	for _, p := range ps {
+		x, y := (p.X-mx)/s, (p.Y-my)/s
+		r := [6]float64{x * x, y * y, x * y, x, y, 1}
+		for i := 0; i < 6; i++ {
+			for k := 0; k < 6; k++ {
+				scatter[i][k] += r[i] * r[k]
+			}
+			trace += r[i] * r[i]
+		}
+	}
+
+	x, y := (j.X-mx)/s, (j.Y-my)/s
+	constraints := [][6]float64{{x * x, y * y, x * y, x, y, 1}}
+	if j.hasTangent {
+		tx, ty := j.tangent.X, j.tangent.Y
+		constraints = append(constraints, [6]float64{2 * x * tx, 2 * y * ty, y*tx + x*ty, tx, ty, 0})
+	}
+	n := smallestEigenVector(constrain(scatter, constraints, trace+1))
+
+	// substitute x = (X - mx) / s back into the normalized conic
+	a, b, c, d, e, f := n[0]/(s*s), n[1]/(s*s), n[2]/(s*s), n[3]/s, n[4]/s, n[5]
+	m.conic = conic{
+		a, b, c,
+		d - 2*a*mx - c*my,
+		e - 2*b*my - c*mx,
+		f + a*mx*mx + b*my*my + c*mx*my - d*mx - e*my,
+	}
+	_, ok = m.conic.toCurve()
+	return m, ok
+}
+
+// constrain restricts s to the complement of the constraint rows, which get
+// the eigen value penalty so the smallest eigen vector satisfies them all.
+func constrain(s [6][6]float64, rows [][6]float64, penalty float64) (out [6][6]float64) {
+	var us [][6]float64
+	for _, r := range rows {
+		for _, u := range us {
+			dot := 0.0
+			for i := range r {
+				dot += r[i] * u[i]
+			}
+			for i := range r {
+				r[i] -= dot * u[i]
+			}
+		}
+		norm := 0.0
+		for i := range r {
+			norm += r[i] * r[i]
+		}
+		if norm == 0 {
+			continue
+		}
+		for i := range r {
+			r[i] /= math.Sqrt(norm)
+		}
+		us = append(us, r)
+	}
+
+	var p [6][6]float64
+	for i := 0; i < 6; i++ {
+		p[i][i] = 1
+		for _, u := range us {
+			for k := 0; k < 6; k++ {
+				p[i][k] -= u[i] * u[k]
+			}
+		}
+	}
+
+	for i := 0; i < 6; i++ {
+		for k := 0; k < 6; k++ {
+			for a := 0; a < 6; a++ {
+				for b := 0; b < 6; b++ {
+					out[i][k] += p[i][a] * s[a][b] * p[b][k]
+				}
+			}
+			for _, u := range us {
+				out[i][k] += penalty * u[i] * u[k]
+			}
+		}
+	}
+	return out
+}
+
+func smallestEigenVector(a [6][6]float64) [6]float64 {
+	var v [6][6]float64
+	for i := range v {
+		v[i][i] = 1
+	}
+
+	for round := 0; round < gJacobiRounds; round++ {
+		off := 0.0
+		for i := 0; i < 6; i++ {
+			for j := i + 1; j < 6; j++ {
+				off += a[i][j] * a[i][j]
+			}
+		}
+		if off < 1e-24 {
+			break
+		}
+
+		for p := 0; p < 6; p++ {
+			for q := p + 1; q < 6; q++ {
+				if a[p][q] == 0 {
+					continue
+				}
+				theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < 6; k++ {
+					akp, akq := a[k][p], a[k][q]
+					a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+				}
+				for k := 0; k < 6; k++ {
+					apk, aqk := a[p][k], a[q][k]
+					a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+				}
+				for k := 0; k < 6; k++ {
+					vkp, vkq := v[k][p], v[k][q]
+					v[k][p], v[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+				}
+			}
+		}
+	}
+
+	min := 0
+	for i := 1; i < 6; i++ {
+		if a[i][i] < a[min][min] {
+			min = i
+		}
+	}
+
+	var x [6]float64
+	for k := 0; k < 6; k++ {
+		x[k] = v[k][min]
+	}
+	return x
+}
+
+func maxDistance(ps []util.FloatPoint, c conic) (max float64) {
+	for _, p := range ps {
+		max = math.Max(max, c.distance(p))
+	}
+	return max
+}
+
+func isXMonotone(ps []util.FloatPoint) bool {
+	for i := 2; i < len(ps); i++ {
+		if (ps[i].X-ps[i-1].X)*(ps[1].X-ps[0].X) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func fitWindow(ps []util.FloatPoint, j joint, tolerance float64) (fitModel, bool) {
+	if m := fitLine(ps, j); maxDistance(ps, m.conic) <= tolerance {
+		return m, true
+	}
+	if !isXMonotone(ps) {
+		return fitModel{}, false
+	}
+	if m, ok := fitConic(ps, j); ok && maxDistance(ps, m.conic) <= tolerance {
+		return m, true
+	}
+	return fitModel{}, false
+}
+
+func longestFit(ps []util.FloatPoint, from int, j joint, tolerance float64) (to int, m fitModel, err error) {
+	to = from + gMinFitPoints - 1
+	if to >= len(ps) {
+		to = len(ps) - 1
+	}
+
+	m, ok := fitWindow(ps[from:to+1], j, tolerance)
+	if (!ok || !isConvertible(curveOf(j, m, ps[to]))) && j.hasTangent {
+		j.hasTangent = false
+		m, ok = fitWindow(ps[from:to+1], j, tolerance)
+	}
+	if !ok || !isConvertible(curveOf(j, m, ps[to])) {
+		// fall back to the chord, as the vendor tracks do near vertical tangents
+		to = from + 1
+		m = fitLine(ps[from:to+1], joint{FloatPoint: j.FloatPoint})
+		if maxDistance(ps[from:to+1], m.conic) > tolerance {
+			return to, m, fmt.Errorf("Can't fit points %d..%d within %.3f", from, to, tolerance)
+		}
+	}
+
+	step := 1
+	for to < len(ps)-1 {
+		next := to + step
+		if next > len(ps)-1 {
+			next = len(ps) - 1
+		}
+		if nm, ok := fitWindow(ps[from:next+1], j, tolerance); ok && isConvertible(curveOf(j, nm, ps[next])) {
+			to, m = next, nm
+			step *= 2
+		} else if step > 1 {
+			step = 1
+		} else {
+			break
+		}
+	}
+	return to, m, nil
+}
+
+func curveOf(start joint, m fitModel, end util.FloatPoint) QuadraticCurve {
+	q := QuadraticCurve{StartPoint: start.FloatPoint, EndPoint: m.jointAt(end).FloatPoint}
+	if !m.isLine {
+		c, _ := m.conic.toCurve()
+		q.CenterPoint, q.RA, q.RB, q.PHI = c.CenterPoint, c.RA, c.RB, c.PHI
+	}
+	return q
+}
+
+// isConvertible tells if ToTrack and NextPoint can walk the curve, the solver
+// gives up near vertical tangents and tiny coordinates.
+func isConvertible(q QuadraticCurve) bool {
+	fs, err := QuadraticCurveArray{q}.ToFunctionArrayAndSplit()
+	if err != nil {
+		return false
+	}
+	_, err = sample("fit", fs, gValidateInterval)
+	return err == nil
+}
+
+func dedup(ps []util.FloatPoint) (out []util.FloatPoint) {
+	for _, p := range ps {
+		if len(out) == 0 || out[len(out)-1].Distance(p) > gMinPointDistance {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func FitCurves(side string, ps []util.FloatPoint, tolerance float64) (qca QuadraticCurveArray, segs []FitSegment, err error) {
+	ps = dedup(ps)
+	if len(ps) < 2 {
+		return nil, nil, fmt.Errorf("Fit %s: need at least 2 distinct points, got %d", side, len(ps))
+	}
+
+	j := joint{FloatPoint: ps[0]}
+	for from := 0; from < len(ps)-1; {
+		to, m, err := longestFit(ps, from, j, tolerance)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Fit %s: %s", side, err)
+		}
+
+		end := m.jointAt(ps[to])
+		q := curveOf(j, m, ps[to])
+
+		window := ps[from : to+1]
+		seg := FitSegment{Side: side, From: from, To: to, IsLine: m.isLine, PointCount: len(window)}
+		seg.MaxError = maxDistance(window, conic(q.toFunction().P))
+
+		qca = append(qca, q)
+		segs = append(segs, seg)
+		j, from = end, to
+	}
+	return qca, segs, nil
+}
+
+func Fit(name string, moveType int, wheelbase float64, front, rear []util.FloatPoint, tolerance float64) (qct QuadraticCurveTrack, segs []FitSegment, err error) {
+	log.Printf("<Fit> %s, move type %d, wheelbase %.0f, %d front and %d rear points\n", name, moveType, wheelbase, len(front), len(rear))
+
+	qct = QuadraticCurveTrack{Name: name, MoveType: moveType, Wheelbase: wheelbase}
+	var fs, rs []FitSegment
+	if qct.Front, fs, err = FitCurves("front", front, tolerance); err != nil {
+		return qct, nil, err
+	}
+	if qct.Rear, rs, err = FitCurves("rear", rear, tolerance); err != nil {
+		return qct, nil, err
+	}
+	segs = append(fs, rs...)
+
+	if err = qct.Validate(wheelbase); err != nil {
+		return qct, segs, err
+	}
+	return qct, segs, nil
+}
+
+func (qct QuadraticCurveTrack) SaveToJSONFile(fileName string) error {
+	out := QuadraticCurveTrack{Name: qct.Name, MoveType: qct.MoveType, Steering: qct.Steering}
+	out.Wheelbase = qct.Wheelbase / gStandardizeScale
+	out.Front = qct.Front.unstandardize()
+	out.Rear = qct.Rear.unstandardize()
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, data, 0644)
+}
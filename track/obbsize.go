@@ -0,0 +1,91 @@
+package track
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+const (
+	gOBBSizeFile    = "data/OBBSize.json"
+	gOBBSizeVersion = 1
+)
+
+type OBBsize struct {
+	Type                      int
+	Front, Rear, Inner, Outer float64
+}
+
+func (s OBBsize) Validate() error {
+	if s.Front <= 0 || s.Rear <= 0 || s.Inner <= 0 || s.Outer <= 0 {
+		return fmt.Errorf("Move type %d: OBB size must be positive, %v", s.Type, s)
+	}
+	return nil
+}
+
+type obbSizeCatalog struct {
+	Version int
+	Sizes   []OBBsize
+}
+
+var gOBBSizes map[int]OBBsize
+
+func LoadOBBSizes(fileName string) error {
+	log.Printf("<LoadOBBSizes> %s\n", fileName)
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	return loadOBBSizes(data, fileName)
+}
+
+func loadOBBSizes(data []byte, fileName string) error {
+	var c obbSizeCatalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return err
+	}
+	if c.Version != gOBBSizeVersion {
+		return fmt.Errorf("OBB sizes %s: unsupported version %d, want %d", fileName, c.Version, gOBBSizeVersion)
+	}
+
+	sizes := make(map[int]OBBsize)
+	for _, s := range c.Sizes {
+		if err := s.Validate(); err != nil {
+			return fmt.Errorf("OBB sizes %s: %s", fileName, err)
+		}
+		if _, ok := sizes[s.Type]; ok {
+			return fmt.Errorf("OBB sizes %s: duplicate move type %d", fileName, s.Type)
+		}
+		sizes[s.Type] = s
+	}
+
+	gOBBSizes = sizes
+	return nil
+}
+
+func GetOBBSize(moveTypeID int) (OBBsize, error) {
+	if gOBBSizes == nil {
+		data, err := gTrackData.ReadFile(gOBBSizeFile)
+		if err != nil {
+			return OBBsize{}, err
+		}
+		if err = loadOBBSizes(data, gOBBSizeFile); err != nil {
+			return OBBsize{}, err
+		}
+	}
+
+	s, ok := gOBBSizes[moveTypeID]
+	if !ok {
+		return OBBsize{}, fmt.Errorf("Unknown OBB size of move type %d", moveTypeID)
+	}
+	return s, nil
+}
@@ -0,0 +1,126 @@
+package track
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"traffic/util"
+)
+
+type Steering int
+
+const (
+	// SteerFront steers the front wheel only, the rear wheel drags along a
+	// tractrix of the front path.
+	SteerFront Steering = iota
+	// SteerCoordinated steers both wheels so the rear retraces the front path.
+	SteerCoordinated
+)
+
+const (
+	gTrailStep         = 1
+	gGenerateTolerance = 1
+)
+
+func (s Steering) String() string {
+	switch s {
+	case SteerFront:
+		return "front"
+	case SteerCoordinated:
+		return "coordinated"
+	default:
+		return fmt.Sprintf("Steering(%d)", int(s))
+	}
+}
+
+func densify(ps []util.FloatPoint, step float64) (out []util.FloatPoint) {
+	out = append(out, ps[0])
+	for i := 1; i < len(ps); i++ {
+		a, b := ps[i-1], ps[i]
+		n := math.Ceil(a.Distance(b) / step)
+		for k := 1.0; k <= n; k++ {
+			out = append(out, util.FloatPoint{X: a.X + (b.X-a.X)*k/n, Y: a.Y + (b.Y-a.Y)*k/n})
+		}
+	}
+	return out
+}
+
+func behind(ps []util.FloatPoint, wheelbase float64) util.FloatPoint {
+	d := math.Hypot(ps[1].X-ps[0].X, ps[1].Y-ps[0].Y)
+	return util.FloatPoint{X: ps[0].X - wheelbase*(ps[1].X-ps[0].X)/d, Y: ps[0].Y - wheelbase*(ps[1].Y-ps[0].Y)/d}
+}
+
+// Trail returns the rear wheel position for each front point, the vehicle
+// starts straight along the first front step.
+func Trail(front []util.FloatPoint, wheelbase float64, steering Steering) ([]util.FloatPoint, error) {
+	front = dedup(front)
+	if len(front) < 2 {
+		return nil, fmt.Errorf("Trail: need at least 2 distinct front points, got %d", len(front))
+	}
+
+	switch steering {
+	case SteerFront:
+		return trailFront(front, wheelbase), nil
+	case SteerCoordinated:
+		return trailCoordinated(front, wheelbase), nil
+	default:
+		return nil, fmt.Errorf("Trail: unsupported steering %s", steering)
+	}
+}
+
+func trailFront(front []util.FloatPoint, wheelbase float64) []util.FloatPoint {
+	r := behind(front, wheelbase)
+	rear := []util.FloatPoint{r}
+	for i := 1; i < len(front); i++ {
+		for _, p := range densify(front[i-1:i+1], gTrailStep)[1:] {
+			d := p.Distance(r)
+			r = util.FloatPoint{X: p.X - wheelbase*(p.X-r.X)/d, Y: p.Y - wheelbase*(p.Y-r.Y)/d}
+		}
+		rear = append(rear, r)
+	}
+	return rear
+}
+
+func trailCoordinated(front []util.FloatPoint, wheelbase float64) (rear []util.FloatPoint) {
+	path := densify(append([]util.FloatPoint{behind(front, wheelbase)}, front...), gTrailStep)
+	j := 0
+	for _, f := range front {
+		for j < len(path)-1 && f.Distance(path[j+1]) >= wheelbase {
+			j++
+		}
+		a, b := path[j], path[j+1]
+		da, db := f.Distance(a), f.Distance(b)
+		k := 0.0
+		if da != db {
+			k = (da - wheelbase) / (da - db)
+		}
+		rear = append(rear, util.FloatPoint{X: a.X + k*(b.X-a.X), Y: a.Y + k*(b.Y-a.Y)})
+	}
+	return rear
+}
+
+func (qct *QuadraticCurveTrack) GenerateRear(wheelbase float64, steering Steering, tolerance float64) ([]FitSegment, error) {
+	log.Printf("<QuadraticCurveTrack.GenerateRear> %s, wheelbase %.0f, steering %s\n", qct.Name, wheelbase, steering)
+
+	t, err := qct.convert()
+	if err != nil {
+		return nil, err
+	}
+
+	front, err := sample("front", t.Front, gValidateInterval)
+	if err != nil {
+		return nil, fmt.Errorf("Track %s: %s", qct.Name, err)
+	}
+	rear, err := Trail(front, wheelbase, steering)
+	if err != nil {
+		return nil, fmt.Errorf("Track %s: %s", qct.Name, err)
+	}
+
+	qca, segs, err := FitCurves("rear", rear, tolerance)
+	if err != nil {
+		return nil, fmt.Errorf("Track %s: %s", qct.Name, err)
+	}
+	qct.Rear = qca
+	qct.Wheelbase, qct.Steering = wheelbase, steering
+	return segs, nil
+}
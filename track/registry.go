@@ -0,0 +1,140 @@
+package track
+
+import (
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+)
+
+//go:embed data/*.json
+var gTrackData embed.FS
+
+type trackEntry struct {
+	qct   QuadraticCurveTrack
+	track Track
+	err   error
+}
+
+var (
+	gTracks      map[int]*trackEntry
+	gTrackByName map[string]int
+)
+
+func loadTracks() error {
+	files, err := gTrackData.ReadDir("data")
+	if err != nil {
+		return err
+	}
+
+	tracks := make(map[int]*trackEntry)
+	byName := make(map[string]int)
+	for _, f := range files {
+		if f.Name() == path.Base(gOBBSizeFile) {
+			continue
+		}
+
+		data, err := gTrackData.ReadFile(path.Join("data", f.Name()))
+		if err != nil {
+			return err
+		}
+
+		e := &trackEntry{}
+		if err = e.qct.loadFromJSON(data); err != nil {
+			return fmt.Errorf("Track %s: %s", f.Name(), err)
+		}
+		if e.qct.Name == "" || e.qct.MoveType == 0 {
+			return fmt.Errorf("Track %s: missing name or move type", f.Name())
+		}
+		if old, ok := tracks[e.qct.MoveType]; ok {
+			return fmt.Errorf("Track %s: move type %d already used by %s", f.Name(), e.qct.MoveType, old.qct.Name)
+		}
+		if _, ok := byName[e.qct.Name]; ok {
+			return fmt.Errorf("Track %s: duplicate name %s", f.Name(), e.qct.Name)
+		}
+
+		if e.qct.Wheelbase <= 0 {
+			return fmt.Errorf("Track %s: missing wheelbase", f.Name())
+		}
+
+		if len(e.qct.Rear) == 0 {
+			_, e.err = e.qct.GenerateRear(e.qct.Wheelbase, e.qct.Steering, gGenerateTolerance)
+		}
+
+		if e.err == nil {
+			e.track, e.err = e.qct.convert()
+		}
+		if e.err == nil {
+			e.err = joinErrors(e.qct.Name, e.track.Validate(e.qct.Wheelbase))
+		}
+		if e.err != nil {
+			log.Printf("<loadTracks> reject %s\n", e.err)
+		}
+
+		tracks[e.qct.MoveType] = e
+		byName[e.qct.Name] = e.qct.MoveType
+	}
+
+	gTracks, gTrackByName = tracks, byName
+	return nil
+}
+
+func GetTrack(moveTypeID int) (t Track, err error) {
+	if gTracks == nil {
+		if err = loadTracks(); err != nil {
+			return t, err
+		}
+	}
+
+	e, ok := gTracks[moveTypeID]
+	if !ok {
+		return t, fmt.Errorf("Unknown track of move type %d", moveTypeID)
+	}
+
+	if e.err != nil {
+		return t, e.err
+	}
+	return e.track, nil
+}
+
+// ValidateMoveType validates the track of a move type against the wheelbase of
+// a vehicle, the track itself is only checked against its declared wheelbase.
+func ValidateMoveType(moveTypeID int, wheelbase float64) error {
+	t, err := GetTrack(moveTypeID)
+	if err != nil {
+		return err
+	}
+	return joinErrors(gTracks[moveTypeID].qct.Name, t.Validate(wheelbase))
+}
+
+func GetTrackByName(name string) (t Track, err error) {
+	if gTrackByName == nil {
+		if err = loadTracks(); err != nil {
+			return t, err
+		}
+	}
+
+	moveTypeID, ok := gTrackByName[name]
+	if !ok {
+		return t, fmt.Errorf("Unknown track %s", name)
+	}
+	return GetTrack(moveTypeID)
+}
+
+func MoveTypes() (ids []int) {
+	if gTracks == nil {
+		if err := loadTracks(); err != nil {
+			log.Printf("<MoveTypes> %s\n", err)
+			return nil
+		}
+	}
+
+	for id, e := range gTracks {
+		if e.err == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,134 @@
+package track
+
+import (
+	"fmt"
+	"math"
+)
+
+const gSpeedInterval = 10
+
+var gMaxCurvatures = make(map[int]float64)
+
+type SpeedPoint struct {
+	S, Curvature, Speed float64
+}
+
+// LateralSpeed returns the speed keeping the lateral acceleration v^2*|k|
+// within maxLateral, a straight path is not limited.
+func LateralSpeed(curvature, maxLateral float64) float64 {
+	if curvature == 0 {
+		return math.Inf(1)
+	}
+	return math.Sqrt(maxLateral / math.Abs(curvature))
+}
+
+func curvatureAt(arcs []Arc, s float64) (float64, error) {
+	offset := 0.0
+	for i, a := range arcs {
+		if s <= offset+a.Length() || i == len(arcs)-1 {
+			return a.CurvatureAt(math.Max(0, math.Min(a.Length(), s-offset)))
+		}
+		offset += a.Length()
+	}
+	return 0, fmt.Errorf("No segment")
+}
+
+func arcsLength(arcs []Arc) (l float64) {
+	for _, a := range arcs {
+		l += a.Length()
+	}
+	return l
+}
+
+// SpeedProfile returns the lateral acceleration limited speed along the front
+// path, the rear is matched by the same fraction of its length and the sharper
+// of the two wheels limits the speed.
+func (t Track) SpeedProfile(maxLateral, interval float64) ([]SpeedPoint, error) {
+	if maxLateral <= 0 {
+		return nil, fmt.Errorf("Invalid lateral acceleration %f", maxLateral)
+	}
+	if len(t.Front) == 0 {
+		return nil, fmt.Errorf("No front segment")
+	}
+	front, err := Arcs(t.Front)
+	if err != nil {
+		return nil, fmt.Errorf("front: %s", err)
+	}
+	rear, err := Arcs(t.Rear)
+	if err != nil {
+		return nil, fmt.Errorf("rear: %s", err)
+	}
+
+	var ps []SpeedPoint
+	var rearErr error
+	ratio := arcsLength(rear) / arcsLength(front)
+	err = EachArcPoint(front, interval, func(p ArcPoint) {
+		k := math.Abs(p.Curvature)
+		if len(rear) > 0 {
+			r, e := curvatureAt(rear, p.S*ratio)
+			if e != nil {
+				rearErr = e
+				return
+			}
+			k = math.Max(k, math.Abs(r))
+		}
+		ps = append(ps, SpeedPoint{S: p.S, Curvature: k, Speed: LateralSpeed(k, maxLateral)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rearErr != nil {
+		return nil, fmt.Errorf("rear: %s", rearErr)
+	}
+	return ps, nil
+}
+
+func (t Track) MaxCurvature() (k float64, err error) {
+	err = t.Each(gSpeedInterval, func(side string, p ArcPoint) {
+		k = math.Max(k, math.Abs(p.Curvature))
+	})
+	return k, err
+}
+
+func MaxCurvature(moveTypeID int) (float64, error) {
+	if k, ok := gMaxCurvatures[moveTypeID]; ok {
+		return k, nil
+	}
+
+	t, err := GetTrack(moveTypeID)
+	if err != nil {
+		return 0, err
+	}
+	k, err := t.MaxCurvature()
+	if err != nil {
+		return 0, fmt.Errorf("Move type %d: %s", moveTypeID, err)
+	}
+	gMaxCurvatures[moveTypeID] = k
+	return k, nil
+}
+
+// SpeedLimit returns the turn speed of a move type for the lateral
+// acceleration, both in mm and seconds.
+func SpeedLimit(moveTypeID int, maxLateral float64) (float64, error) {
+	if maxLateral <= 0 {
+		return 0, fmt.Errorf("Invalid lateral acceleration %f", maxLateral)
+	}
+	k, err := MaxCurvature(moveTypeID)
+	if err != nil {
+		return 0, err
+	}
+	return LateralSpeed(k, maxLateral), nil
+}
+
+// SpeedLimits returns the turn speed of every valid move type.
+func SpeedLimits(maxLateral float64) (map[int]float64, error) {
+	limits := make(map[int]float64)
+	for _, id := range MoveTypes() {
+		v, err := SpeedLimit(id, maxLateral)
+		if err != nil {
+			return nil, err
+		}
+		limits[id] = v
+	}
+	return limits, nil
+}
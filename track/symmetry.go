@@ -0,0 +1,50 @@
+package track
+
+import "traffic/util"
+
+// Apply maps the segment by s. The conic becomes f(M^T p) for the orthogonal
+// M of s, so the quadratic part is M Q M^T and the linear part M L. The y(x)
+// solvers of NextPoint need the segment split at its vertical tangents, which
+// a quarter turn moves, so g is walked on f and the points mapped by s.
+func (f Function) Apply(s util.Symmetry) Function {
+	u, v := s.Point(util.FloatPoint{X: 1}), s.Point(util.FloatPoint{Y: 1})
+	m := [2][2]float64{{u.X, v.X}, {u.Y, v.Y}}
+	q := [2][2]float64{{f.P[0], f.P[2] / 2}, {f.P[2] / 2, f.P[1]}}
+
+	var mq, r [2][2]float64
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			mq[i][j] = m[i][0]*q[0][j] + m[i][1]*q[1][j]
+		}
+	}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 2; j++ {
+			r[i][j] = mq[i][0]*m[j][0] + mq[i][1]*m[j][1]
+		}
+	}
+
+	g := f
+	g.Start, g.End = s.Point(f.Start), s.Point(f.End)
+	g.P = [6]float64{r[0][0], r[1][1], 2 * r[0][1],
+		m[0][0]*f.P[3] + m[0][1]*f.P[4], m[1][0]*f.P[3] + m[1][1]*f.P[4], f.P[5]}
+	g.recognizeType()
+	g.base, g.sym = &f, s
+	return g
+}
+
+// Apply maps both sides of the track by s.
+func (t Track) Apply(s util.Symmetry) (r Track) {
+	for _, f := range t.Front {
+		r.Front = append(r.Front, f.Apply(s))
+	}
+	for _, f := range t.Rear {
+		r.Rear = append(r.Rear, f.Apply(s))
+	}
+	return r
+}
+
+// Transform maps a base track, turning from XInc to YInc, onto the turn from
+// d1 to d2.
+func (t Track) Transform(d1, d2 util.Direction) Track {
+	return t.Apply(util.NewSymmetry(d1, d2))
+}
@@ -21,6 +21,8 @@ type Function struct {
 	Type       int
 	Start, End util.FloatPoint
 	sign       float64
+	base       *Function // set by Apply, the function is walked as sym of base
+	sym        util.Symmetry
 	P          [6]float64 // f(x,y) = ax2 + by2 + cxy + dx + ey + f
 }
 
@@ -56,12 +58,12 @@ func (f Function) IsCenterPoint(p util.FloatPoint) bool {
 }
 
 func (f Function) Verify() (bool, error) {
-	if f.Evaluate(f.Start) != 0 {
-		return false, fmt.Errorf("Start Evaluate is %d, not equal 0", f.Evaluate(f.Start))
+	if d := f.Distance(f.Start); d > gOnCurveTolerance {
+		return false, fmt.Errorf("Start is %f off the curve", d)
 	}
 
-	if f.Evaluate(f.End) != 0 {
-		return false, fmt.Errorf("End Evaluate is %d, not equal 0", f.Evaluate(f.End))
+	if d := f.Distance(f.End); d > gOnCurveTolerance {
+		return false, fmt.Errorf("End is %f off the curve", d)
 	}
 
 	return true, nil
@@ -79,10 +81,14 @@ func (f *Function) recognizeType() {
 	}
 }
 
-func (f *Function) recognizeSign() {
+func (f *Function) recognizeSign() error {
 	switch f.Type {
 	case XYQ:
-		f.sign = float64(f.SectionSignDX())
+		sign, err := f.SectionSignDX()
+		if err != nil {
+			return err
+		}
+		f.sign = float64(sign)
 
 	case XL:
 		if f.Start.Y < f.End.Y {
@@ -92,6 +98,7 @@ func (f *Function) recognizeSign() {
 		}
 	}
 
+	return nil
 }
 
 func (f Function) SignXYQdy(p util.FloatPoint) (bool, int) {
@@ -107,38 +114,45 @@ func (f Function) SignXYQdy(p util.FloatPoint) (bool, int) {
 	}
 }
 
-func (f Function) SignXYQdx(p util.FloatPoint) (bool, int) {
+// isOnBranch tells if the solved y is p.Y, the points of a track file are
+// rounded so y of a point near the x axis is only close in mm.
+func isOnBranch(y, pY float64) bool {
+	return util.FloatEqual(y, pY) || util.FloatEqualTolerance(y, pY, gOnCurveTolerance)
+}
+
+func (f Function) SignXYQdx(p util.FloatPoint) (int, error) {
 	y1 := f.YSolverXYQ(1, p.X)
 	y2 := f.YSolverXYQ(-1, p.X)
 
-	if util.FloatEqual(y1, p.Y) {
-		return true, 1
-	} else if util.FloatEqual(y2, p.Y) {
-		return true, -1
-	} else {
-		log.Print(y1, y2, p.Y)
-		panic("")
-		return false, 0
+	if isOnBranch(y1, p.Y) {
+		return 1, nil
+	} else if isOnBranch(y2, p.Y) {
+		return -1, nil
+	} else if math.IsNaN(y1) && f.Distance(p) <= gOnCurveTolerance {
+		// p is the vertical tangent, rounded just outside the curve
+		return 0, nil
 	}
+	return 0, fmt.Errorf("Point %v is on neither branch, y is %f or %f", p, y1, y2)
 }
 
-func (f Function) SectionSignDX() int {
+func (f Function) SectionSignDX() (int, error) {
 	switch f.Type {
 	case XYQ:
-		resStart, SignStart := f.SignXYQdx(f.Start)
-		resEnd, SignEnd := f.SignXYQdx(f.End)
-		if !resStart || !resEnd {
-			panic("")
+		SignStart, err := f.SignXYQdx(f.Start)
+		if err != nil {
+			return 0, fmt.Errorf("Start: %s", err)
+		}
+		SignEnd, err := f.SignXYQdx(f.End)
+		if err != nil {
+			return 0, fmt.Errorf("End: %s", err)
 		}
 
-		if resStart || resEnd {
-			if SignStart == SignEnd {
-				return SignStart
-			} else if SignStart == 0 {
-				return SignEnd
-			} else if SignEnd == 0 {
-				return SignStart
-			}
+		if SignStart == SignEnd {
+			return SignStart, nil
+		} else if SignStart == 0 {
+			return SignEnd, nil
+		} else if SignEnd == 0 {
+			return SignStart, nil
 		}
 
 	case XL:
@@ -149,7 +163,7 @@ func (f Function) SectionSignDX() int {
 		}
 	}
 
-	return 0
+	return 0, nil
 }
 
 func (f Function) SectionSignDY() int {
@@ -160,7 +174,6 @@ func (f Function) SectionSignDY() int {
 		resEnd, SignEnd := f.SignXYQdy(f.End)
 		if !resStart || !resEnd {
 			return 0
-			panic("")
 		}
 
 		if resStart || resEnd {
@@ -289,18 +302,44 @@ type QuadraticCurve struct {
 
 type QuadraticCurveArray []QuadraticCurve
 
+var gStandardizeShift = util.FloatPoint{-7, 0}
+
+const gStandardizeScale = 100
+
 func (q *QuadraticCurve) standardize() {
-	standardizeShift := util.FloatPoint{-7, 0}
+	q.StartPoint = q.StartPoint.Shift(gStandardizeShift).Scale(gStandardizeScale)
+	q.CenterPoint = q.CenterPoint.Shift(gStandardizeShift).Scale(gStandardizeScale)
+	q.EndPoint = q.EndPoint.Shift(gStandardizeShift).Scale(gStandardizeScale)
+	q.RA *= gStandardizeScale
+	q.RB *= gStandardizeScale
+}
 
-	q.StartPoint = q.StartPoint.Shift(standardizeShift).Scale(100)
-	q.CenterPoint = q.CenterPoint.Shift(standardizeShift).Scale(100)
-	q.EndPoint = q.EndPoint.Shift(standardizeShift).Scale(100)
-	q.RA *= 100
-	q.RB *= 100
+func (q QuadraticCurve) unstandardize() QuadraticCurve {
+	back := gStandardizeShift.Scale(-1)
+	q.StartPoint = q.StartPoint.Scale(1.0 / gStandardizeScale).Shift(back)
+	q.EndPoint = q.EndPoint.Scale(1.0 / gStandardizeScale).Shift(back)
+	if q.RA == 0 && q.RB == 0 {
+		q.CenterPoint = util.FloatPointZero
+	} else {
+		q.CenterPoint = q.CenterPoint.Scale(1.0 / gStandardizeScale).Shift(back)
+	}
+	q.RA /= gStandardizeScale
+	q.RB /= gStandardizeScale
+	return q
+}
+
+func (qca QuadraticCurveArray) unstandardize() (out QuadraticCurveArray) {
+	for _, q := range qca {
+		out = append(out, q.unstandardize())
+	}
+	return out
 }
 
 type QuadraticCurveTrack struct {
 	Name        string
+	MoveType    int
+	Wheelbase   float64  `json:",omitempty"`
+	Steering    Steering `json:",omitempty"`
 	Front, Rear QuadraticCurveArray
 }
 
@@ -342,26 +381,52 @@ func (t Track) ToCCode() {
 	}
 }
 
-func GetTrack(moveTypeID int) (t Track, err error) {
-	var qct QuadraticCurveTrack
-	err = qct.LoadFromJSONFile("track/data/QTurn4to7.json")
-	if err != nil {
-		return t, err
-	}
+func (t Track) Walk(interval, wheelbase float64, visit func(front, rear util.FloatPoint)) error {
+	var f, r util.FloatPoint
+	rn := 0
+	for fn := 0; fn < len(t.Front); {
+		nextFront, res, err := t.Front[fn].NextPoint(f, interval)
+		if err != nil {
+			return fmt.Errorf("Front %d: %s", fn, err)
+		}
+		if res == NotFount {
+			return fmt.Errorf("Can't find next front %d", fn)
+		}
 
-	t = qct.ToTrack()
-	log.Print(t)
-	return t, nil
-}
+		for rn < len(t.Rear) {
+			nextRear, res := t.Rear[rn].NextPointRef(r, nextFront, wheelbase)
+			if res == NotFount {
+				rn++
+				nextRear = util.FloatPointZero
+				continue
+			}
 
-type OBBsize struct {
-	Type                      int
-	Front, Rear, Inner, Outer float64
-}
+			isBreak := nextFront.Distance(nextRear) < wheelbase+10
+			if isBreak {
+				visit(nextFront, nextRear)
+			}
 
-func GetOBBSize(moveTypeID int) (OBBsize, error) {
-	var t OBBsize
-	return t, nil
+			if res == EndPoint {
+				rn++
+				r = util.FloatPointZero
+			} else {
+				r = nextRear
+			}
+
+			if isBreak {
+				break
+			}
+		}
+
+		if res == EndPoint {
+			fn++
+			f = util.FloatPointZero
+		} else {
+			f = nextFront
+		}
+	}
+
+	return nil
 }
 
 func calcLineFunc(f *Function) {
@@ -372,7 +437,7 @@ func calcLineFunc(f *Function) {
 	if f.Start.X == f.End.X {
 		f.P[3] = -1
 		f.P[4] = 0
-		f.P[5] = 0
+		f.P[5] = f.Start.X
 	} else {
 		k := (f.End.Y - f.Start.Y) / (f.End.X - f.Start.X)
 		b := f.End.Y - k*f.End.X
@@ -434,7 +499,7 @@ func (q QuadraticCurve) toFunction() (f Function) {
 	return f
 }
 
-func (qca QuadraticCurveArray) ToFunctionArrayAndSplit() (fArray []Function) {
+func (qca QuadraticCurveArray) ToFunctionArrayAndSplit() (fArray []Function, err error) {
 	for _, qc := range qca {
 		fArray = append(fArray, qc.toFunction())
 
@@ -459,10 +524,12 @@ func (qca QuadraticCurveArray) ToFunctionArrayAndSplit() (fArray []Function) {
 	}
 
 	for i := 0; i < len(fArray); i++ {
-		fArray[i].recognizeSign()
+		if err = fArray[i].recognizeSign(); err != nil {
+			return nil, fmt.Errorf("Segment %d: %s", i, err)
+		}
 	}
 
-	return fArray
+	return fArray, nil
 }
 
 func (qct *QuadraticCurveTrack) standardize() {
@@ -475,6 +542,8 @@ func (qct *QuadraticCurveTrack) standardize() {
 		f := &qct.Rear[i]
 		f.standardize()
 	}
+
+	qct.Wheelbase *= gStandardizeScale
 }
 
 func (qct *QuadraticCurveTrack) LoadFromJSONFile(fileName string) error {
@@ -484,22 +553,34 @@ func (qct *QuadraticCurveTrack) LoadFromJSONFile(fileName string) error {
 		return err
 	}
 
+	defer f.Close()
+
 	data, err := ioutil.ReadAll(f)
-	err = json.Unmarshal(data, &qct)
 	if err != nil {
 		return err
 	}
+	return qct.loadFromJSON(data)
+}
+
+func (qct *QuadraticCurveTrack) loadFromJSON(data []byte) error {
+	if err := json.Unmarshal(data, qct); err != nil {
+		return err
+	}
 
 	qct.standardize()
 	return nil
 }
 
-func (qct QuadraticCurveTrack) ToTrack() (t Track) {
+func (qct QuadraticCurveTrack) ToTrack() (t Track, err error) {
 	log.Print("Front")
-	t.Front = qct.Front.ToFunctionArrayAndSplit()
+	if t.Front, err = qct.Front.ToFunctionArrayAndSplit(); err != nil {
+		return t, fmt.Errorf("Front: %s", err)
+	}
 	log.Print("Rear")
-	t.Rear = qct.Rear.ToFunctionArrayAndSplit()
-	return t
+	if t.Rear, err = qct.Rear.ToFunctionArrayAndSplit(); err != nil {
+		return t, fmt.Errorf("Rear: %s", err)
+	}
+	return t, nil
 }
 
 func (f Function) dxXYQ(current util.FloatPoint, interval float64) (x0 float64) {
@@ -576,34 +657,43 @@ const (
 	EndPoint
 )
 
-func (f Function) NextPoint(current util.FloatPoint, interval float64) (next util.FloatPoint, res int) {
-	defer func() {
-		log.Print(current, next, res)
-	}()
+func (f Function) NextPoint(current util.FloatPoint, interval float64) (next util.FloatPoint, res int, err error) {
 	p := f.P
 
 	if current.Equal(util.FloatPointZero) {
-		return f.Start, StartPoint
+		return f.Start, StartPoint, nil
+	}
+
+	if f.base != nil {
+		next, res, err = f.base.NextPoint(f.sym.Inverse().Point(current), interval)
+		return f.sym.Point(next), res, err
 	}
 
 	switch f.Type {
 	case XYQ:
 		next.X = f.dxXYQ(current, interval)
 		if !util.FloatInCloseInterval(next.X, f.Start.X, f.End.X, 0.01) {
-			return f.End, EndPoint
+			return f.End, EndPoint, nil
 		}
 		next.Y = f.YSolverXYQ(f.sign, next.X)
+		if math.IsNaN(next.Y) {
+			if next.X == f.End.X {
+				// End is the vertical tangent, rounded just outside the curve
+				return f.End, EndPoint, nil
+			}
+			return next, NotFount, fmt.Errorf("No point at x %f", next.X)
+		}
 
 	case XL:
 		next = util.FloatPoint{f.Start.X, current.Y + f.sign*interval}
 		if !util.FloatInCloseInterval(next.Y, f.Start.Y, f.End.Y, 0.01) {
-			return f.End, EndPoint
+			return f.End, EndPoint, nil
 		}
 
 	case XQYL:
 		next.X = f.dxXQYL(current, current, interval)
 		if !util.FloatInCloseInterval(next.X, f.Start.X, f.End.X, 0.01) {
-			return f.End, EndPoint
+			return f.End, EndPoint, nil
 		}
 
 		C := p[2]*next.X + p[4]
@@ -612,23 +702,23 @@ func (f Function) NextPoint(current util.FloatPoint, interval float64) (next uti
 	case XYL:
 		next.X = current.X + math.Copysign(interval/math.Sqrt(1+math.Pow(p[3]/p[4], 2)), f.End.X-f.Start.X)
 		if !util.FloatInCloseInterval(next.X, f.Start.X, f.End.X, 0.01) {
-			return f.End, EndPoint
+			return f.End, EndPoint, nil
 		}
 		next.Y = -(p[3]*next.X + p[5]) / p[4]
 
 	default:
-		return next, NotFount
+		return next, NotFount, nil
 	}
 
-	if next.Equal(current) {
-		panic("")
+	if next.Equal(f.End) {
+		return f.End, EndPoint, nil
 	}
 
-	if next.Equal(f.End) {
-		return f.End, EndPoint
+	if next == current {
+		return next, NotFount, fmt.Errorf("Stuck at %v", current)
 	}
 
-	return next, CenterPoint
+	return next, CenterPoint, nil
 }
 
 func (f Function) NextPointRef(current, ref util.FloatPoint, interval float64) (next util.FloatPoint, res int) {
@@ -638,6 +728,12 @@ func (f Function) NextPointRef(current, ref util.FloatPoint, interval float64) (
 		return f.Start, StartPoint
 	}
 
+	if f.base != nil {
+		inv := f.sym.Inverse()
+		next, res = f.base.NextPointRef(inv.Point(current), inv.Point(ref), interval)
+		return f.sym.Point(next), res
+	}
+
 	switch f.Type {
 	case XYQ:
 		next.X = f.dxXYQ(ref, interval)
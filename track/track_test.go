@@ -3,6 +3,9 @@ package track
 import (
 	"log"
 	"math"
+	"path"
+	"reflect"
+	"sort"
 	"testing"
 	"traffic/util"
 )
@@ -54,8 +57,8 @@ func TestFunction_SignXYQdx_Circle(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		res, s := f.SignXYQdx(c)
-		log.Print("  ", c, res, s)
+		s, err := f.SignXYQdx(c)
+		log.Print("  ", c, s, err)
 	}
 
 }
@@ -74,8 +77,8 @@ func TestFunction_SignXYQdx_Hyperbola1(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		res, s := f.SignXYQdx(c)
-		log.Print("  ", c, res, s)
+		s, err := f.SignXYQdx(c)
+		log.Print("  ", c, s, err)
 	}
 
 }
@@ -94,8 +97,380 @@ func TestFunction_SignXYQdx_Hyperbola2(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		res, s := f.SignXYQdx(c)
-		log.Print("  ", c, res, s)
+		s, err := f.SignXYQdx(c)
+		log.Print("  ", c, s, err)
 	}
 
 }
+
+func TestLoadOBBSizes(t *testing.T) {
+	if err := LoadOBBSizes("data/OBBSize.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := GetOBBSize(10)
+	if err != nil || s.Front <= 0 || s.Outer <= 0 {
+		t.Errorf("want OBB size of move type 10, result %v %v", s, err)
+	}
+	if _, err = GetOBBSize(-1); err == nil {
+		t.Error("want error for unknown move type")
+	}
+	if err = (OBBsize{Type: 1, Front: 900}).Validate(); err == nil {
+		t.Error("want error for zero OBB size")
+	}
+}
+
+func TestGetTrack(t *testing.T) {
+	files, err := gTrackData.ReadDir("data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var shipped []int
+	for _, f := range files {
+		if f.Name() == path.Base(gOBBSizeFile) {
+			continue
+		}
+
+		var qct QuadraticCurveTrack
+		if err := qct.LoadFromJSONFile(path.Join("data", f.Name())); err != nil {
+			t.Fatal(err)
+		}
+		shipped = append(shipped, qct.MoveType)
+
+		tk, err := GetTrack(qct.MoveType)
+		if err != nil || len(tk.Front) == 0 || len(tk.Rear) == 0 {
+			t.Errorf("want track of move type %d, result %v", qct.MoveType, err)
+		}
+		if byName, err := GetTrackByName(qct.Name); err != nil || len(byName.Front) != len(tk.Front) {
+			t.Errorf("want %s same as move type %d, result %v", qct.Name, qct.MoveType, err)
+		}
+	}
+
+	sort.Ints(shipped)
+	if ids := MoveTypes(); !reflect.DeepEqual(ids, shipped) {
+		t.Errorf("want every shipped move type %v valid, result %v", shipped, ids)
+	}
+
+	if _, err = GetTrack(-1); err == nil {
+		t.Error("want error for unknown move type")
+	}
+	if err = ValidateMoveType(10, 2000); err == nil {
+		t.Error("want error for wheelbase other than declared")
+	}
+	if _, err = GetTrackByName("QTurn0to0"); err == nil {
+		t.Error("want error for unknown track name")
+	}
+}
+
+func lineTrack(front, rear []util.FloatPoint) (t Track) {
+	for i := 1; i < len(front); i++ {
+		t.Front = append(t.Front, QuadraticCurve{StartPoint: front[i-1], EndPoint: front[i]}.toFunction())
+	}
+	for i := 1; i < len(rear); i++ {
+		t.Rear = append(t.Rear, QuadraticCurve{StartPoint: rear[i-1], EndPoint: rear[i]}.toFunction())
+	}
+	return t
+}
+
+func TestTrack_Validate(t *testing.T) {
+	front := []util.FloatPoint{{X: 0, Y: 100}, {X: 1000, Y: 100}, {X: 2000, Y: 100}}
+	rear := []util.FloatPoint{{X: -1200, Y: 100}, {X: 800, Y: 100}}
+
+	tk := lineTrack(front, rear)
+	if errs := tk.Validate(1200); len(errs) != 0 {
+		t.Errorf("want valid track, result %v", errs)
+	}
+	if tk.Wheelbase() != 1200 {
+		t.Errorf("want wheelbase 1200, result %f", tk.Wheelbase())
+	}
+	if errs := tk.Validate(1000); len(errs) == 0 {
+		t.Error("want wheelbase error")
+	}
+
+	tk.Front[1].Start = util.FloatPoint{X: 1000, Y: 150}
+	errs := tk.Validate(1200)
+	if len(errs) == 0 {
+		t.Fatal("want joint error")
+	}
+	if e, ok := errs[0].(SegmentError); !ok || e.Side != "front" || e.Index != 1 {
+		t.Errorf("want error at front 1, result %v", errs)
+	}
+}
+
+func quarterTurn(step float64) (ps []util.FloatPoint) {
+	for x := -700.0; x < -300; x += step {
+		ps = append(ps, util.FloatPoint{X: x, Y: 0})
+	}
+	for a := 0.0; a < 90; a += step / 10 {
+		rad := a * math.Pi / 180
+		ps = append(ps, util.FloatPoint{X: -300 + 1000*math.Sin(rad), Y: 1000 - 1000*math.Cos(rad)})
+	}
+	for y := 1000.0; y <= 1500; y += step {
+		ps = append(ps, util.FloatPoint{X: 700, Y: y})
+	}
+	return ps
+}
+
+func trailing(front []util.FloatPoint, wheelbase float64) (rear []util.FloatPoint) {
+	r := front[0].Shift(util.FloatPoint{X: -wheelbase, Y: 0})
+	for _, f := range front {
+		d := f.Distance(r)
+		r = util.FloatPoint{X: f.X - wheelbase*(f.X-r.X)/d, Y: f.Y - wheelbase*(f.Y-r.Y)/d}
+		rear = append(rear, r)
+	}
+	return rear
+}
+
+func TestFitCurves(t *testing.T) {
+	ps := quarterTurn(20)
+	qca, segs, err := FitCurves("front", ps, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range segs {
+		if s.MaxError > 1 {
+			t.Errorf("want max error within 1, result %s", s)
+		}
+	}
+	if len(qca) < 2 || segs[0].From != 0 || segs[len(segs)-1].To != len(ps)-1 || !segs[len(segs)-1].IsLine {
+		t.Errorf("want segments covering all points and ending with line, result %v", segs)
+	}
+	for i := 1; i < len(qca); i++ {
+		if !qca[i].StartPoint.Equal(qca[i-1].EndPoint) {
+			t.Errorf("want segment %d start at previous end, result %v", i, qca[i])
+		}
+	}
+	if q := qca[0]; !q.StartPoint.Equal(ps[0]) {
+		t.Errorf("want start at %v, result %v", ps[0], q.StartPoint)
+	}
+}
+
+func TestFit(t *testing.T) {
+	front := quarterTurn(5)
+	rear := trailing(front, 1200)
+
+	qct, segs, err := Fit("QTurnFit", 99, 1200, front, rear, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Print(segs)
+	if _, _, err = Fit("QTurnFit", 99, 2000, front, rear, 1); err == nil {
+		t.Error("want error for rear not a vehicle wheelbase behind")
+	}
+
+	fileName := t.TempDir() + "/QTurnFit.json"
+	if err = qct.SaveToJSONFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if err = ValidateFile(fileName, 1200); err != nil {
+		t.Error(err)
+	}
+
+	var loaded QuadraticCurveTrack
+	if err = loaded.LoadFromJSONFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.MoveType != 99 || loaded.Wheelbase != 1200 || len(loaded.Front) != len(qct.Front) || !loaded.Front[0].StartPoint.Equal(qct.Front[0].StartPoint) {
+		t.Errorf("want saved track loaded back, result %v", loaded)
+	}
+}
+
+func TestTrail(t *testing.T) {
+	front := quarterTurn(5)
+	rear, err := Trail(front, 1200, SteerFront)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range rear {
+		if !util.FloatEqualTolerance(r.Distance(front[i]), 1200, 0.5) {
+			t.Fatalf("want rear %d a wheelbase behind, result %v %v", i, front[i], r)
+		}
+	}
+	center := util.FloatPoint{X: -300, Y: 1000}
+	if last := rear[len(rear)-1]; last.Distance(center) > 900 {
+		t.Errorf("want rear cutting inside the turn, result %v", last)
+	}
+
+	rear, err = Trail(front, 1200, SteerCoordinated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := rear[len(rear)-1]; !util.FloatEqualTolerance(last.Distance(center), 1000, 0.5) {
+		t.Errorf("want rear retracing front path, result %v", last)
+	}
+
+	if _, err = Trail(front, 1200, Steering(9)); err == nil {
+		t.Error("want error for unsupported steering")
+	}
+}
+
+func TestQuadraticCurveTrack_GenerateRear(t *testing.T) {
+	front := quarterTurn(5)
+	qca, _, err := FitCurves("front", front, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	qct := QuadraticCurveTrack{Name: "QTurnFrontOnly", MoveType: 98, Front: qca}
+	if _, err = qct.GenerateRear(1200, SteerFront, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(qct.Rear) == 0 || qct.Wheelbase != 1200 {
+		t.Errorf("want rear generated, result %v", qct)
+	}
+	if err = qct.Validate(1200); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestArc(t *testing.T) {
+	circle := Function{Type: XYQ, Start: util.FloatPoint{X: 1000, Y: 0}, End: util.FloatPoint{X: 0, Y: 1000},
+		P: [6]float64{1, 1, 0, 0, 0, -1e6}}
+	a, err := circle.Arc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := a.Length(); !util.FloatEqualTolerance(l, 500*math.Pi, 0.1) {
+		t.Errorf("want length %.3f, result %.3f", 500*math.Pi, l)
+	}
+	if p, err := a.PointAt(a.Length() / 2); err != nil || !util.FloatEqualTolerance(p.X, 707.107, 0.1) ||
+		!util.FloatEqualTolerance(p.Y, 707.107, 0.1) {
+		t.Errorf("want middle (707.107, 707.107), result %v %v", p, err)
+	}
+	if deg, err := a.TangentAt(0); err != nil || !deg.Equal(90) {
+		t.Errorf("want tangent 90 at start, result %v %v", deg, err)
+	}
+	if k, err := a.CurvatureAt(100); err != nil || !util.FloatEqualTolerance(k, 0.001, 1e-6) {
+		t.Errorf("want curvature 0.001 turning left, result %v %v", k, err)
+	}
+	if _, err := a.PointAt(a.Length() + 1); err == nil {
+		t.Error("want error beyond the end")
+	}
+
+	circle.Start, circle.End = circle.End, circle.Start
+	if a, err = circle.Arc(); err != nil {
+		t.Fatal(err)
+	}
+	if k, err := a.CurvatureAt(100); err != nil || !util.FloatEqualTolerance(k, -0.001, 1e-6) {
+		t.Errorf("want curvature -0.001 turning right, result %v %v", k, err)
+	}
+
+	circle.End = util.FloatPoint{X: 0, Y: 900}
+	if _, err := circle.Arc(); err == nil {
+		t.Error("want error for end off the curve")
+	}
+}
+
+func TestTrack_Each(t *testing.T) {
+	tk := lineTrack([]util.FloatPoint{{X: 0, Y: 100}, {X: 1000, Y: 100}, {X: 2050, Y: 100}},
+		[]util.FloatPoint{{X: -1200, Y: 100}, {X: 800, Y: 100}})
+	var front, rear []ArcPoint
+	err := tk.Each(100, func(side string, p ArcPoint) {
+		if side == "front" {
+			front = append(front, p)
+		} else {
+			rear = append(rear, p)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(front) != 22 || front[11].Index != 1 || !util.FloatEqual(front[21].S, 2050) || front[21].X != 2050 {
+		t.Errorf("want 22 front points ending at 2050, result %v", front)
+	}
+	if len(rear) != 21 || !rear[5].Tangent.Equal(0) || rear[5].Curvature != 0 {
+		t.Errorf("want 21 straight rear points, result %v", rear)
+	}
+
+	if tk, err = GetTrack(10); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	if err := tk.Each(gValidateInterval, func(side string, p ArcPoint) { n++ }); err != nil || n == 0 {
+		t.Errorf("want track 10 sampled, result %d points %v", n, err)
+	}
+}
+
+func TestTrack_SpeedProfile(t *testing.T) {
+	circle := Function{Type: XYQ, Start: util.FloatPoint{X: 1000, Y: 0}, End: util.FloatPoint{X: 0, Y: 1000},
+		P: [6]float64{1, 1, 0, 0, 0, -1e6}}
+	tk := lineTrack([]util.FloatPoint{{X: 1000, Y: -500}, {X: 1000, Y: 0}}, []util.FloatPoint{{X: 1000, Y: -1700}, {X: 1000, Y: -1200}})
+	tk.Front = append(tk.Front, circle)
+
+	ps, err := tk.SpeedProfile(1000, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsInf(ps[0].Speed, 1) || !util.FloatEqualTolerance(ps[len(ps)-1].Speed, 1000, 1) {
+		t.Errorf("want unlimited on the line and 1000 on the arc, result %v", ps)
+	}
+	if _, err := tk.SpeedProfile(0, 100); err == nil {
+		t.Error("want error for zero lateral acceleration")
+	}
+
+	v, err := SpeedLimit(10, 300)
+	if err != nil || v <= 0 || math.IsInf(v, 1) {
+		t.Errorf("want move type 10 limited, result %f %v", v, err)
+	}
+	if _, err := SpeedLimit(-1, 300); err == nil {
+		t.Error("want error for unknown move type")
+	}
+}
+
+func TestTrack_Apply(t *testing.T) {
+	base, err := GetTrack(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range util.Symmetries() {
+		tk := base.Apply(s)
+		if !tk.Front[0].Start.Equal(s.Point(base.Front[0].Start)) || !util.FloatEqual(tk.Wheelbase(), base.Wheelbase()) {
+			t.Errorf("%s: want start mapped, result %v", s, tk.Front[0].Start)
+		}
+
+		var want, result []ArcPoint
+		base.Each(100, func(side string, p ArcPoint) { want = append(want, p) })
+		if err := tk.Each(100, func(side string, p ArcPoint) { result = append(result, p) }); err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+		for i, p := range want {
+			q := s.Point(p.FloatPoint)
+			if q.Distance(result[i].FloatPoint) > 0.01 || math.Abs(math.Remainder(float64(s.Degree(p.Tangent)-result[i].Tangent), 360)) > 0.01 {
+				t.Fatalf("%s: want %v heading %v, result %v", s, q, s.Degree(p.Tangent), result[i])
+			}
+		}
+	}
+
+	for _, id := range MoveTypes() {
+		base, _ := GetTrack(id)
+		wheelbase := gTracks[id].qct.Wheelbase
+		var want [][2]util.FloatPoint
+		base.Walk(10, wheelbase, func(front, rear util.FloatPoint) { want = append(want, [2]util.FloatPoint{front, rear}) })
+
+		for _, s := range util.Symmetries() {
+			tk := base.Apply(s)
+			var result [][2]util.FloatPoint
+			if err := tk.Walk(10, wheelbase, func(front, rear util.FloatPoint) {
+				result = append(result, [2]util.FloatPoint{front, rear})
+			}); err != nil {
+				t.Errorf("move type %d %s: %s", id, s, err)
+				continue
+			}
+			if len(result) != len(want) || len(want) == 0 {
+				t.Errorf("move type %d %s: want %d points, result %d", id, s, len(want), len(result))
+				continue
+			}
+			for i, p := range want {
+				if s.Point(p[0]).Distance(result[i][0]) > 0.01 || s.Point(p[1]).Distance(result[i][1]) > 0.01 {
+					t.Errorf("move type %d %s: want %v, result %v", id, s, p, result[i])
+					break
+				}
+			}
+			if errs := tk.Validate(wheelbase); len(errs) > 0 {
+				t.Errorf("move type %d %s: %v", id, s, errs)
+			}
+		}
+	}
+}
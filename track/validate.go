@@ -0,0 +1,176 @@
+package track
+
+import (
+	"fmt"
+	"math"
+	"traffic/util"
+)
+
+const (
+	gOnCurveTolerance   = 1
+	gJointTolerance     = 1
+	gTangentTolerance   = 10
+	gWheelbaseTolerance = 20
+	gValidateInterval   = 10
+)
+
+type SegmentError struct {
+	Side  string
+	Index int
+	Msg   string
+}
+
+func (e SegmentError) Error() string {
+	return fmt.Sprintf("%s %d: %s", e.Side, e.Index, e.Msg)
+}
+
+func (f Function) gradient(p util.FloatPoint) (gx, gy float64) {
+	return 2*f.P[0]*p.X + f.P[2]*p.Y + f.P[3], 2*f.P[1]*p.Y + f.P[2]*p.X + f.P[4]
+}
+
+// Distance approximates the distance from p to the conic by the first order
+// expansion |f(p)| / |grad f(p)|, P is rescaled by toFunction so raw values
+// of Evaluate are not comparable between functions.
+func (f Function) Distance(p util.FloatPoint) float64 {
+	gx, gy := f.gradient(p)
+	n := math.Hypot(gx, gy)
+	if n == 0 {
+		return math.Inf(1)
+	}
+	return math.Abs(f.Evaluate(p)) / n
+}
+
+func (f Function) tangentOf(p util.FloatPoint) util.Degree {
+	gx, gy := f.gradient(p)
+	return util.Degree(math.Atan2(gx, -gy) * 180 / math.Pi).Normalize()
+}
+
+func validateSide(side string, fs []Function) (errs []error) {
+	if len(fs) == 0 {
+		return []error{SegmentError{side, 0, "no segment"}}
+	}
+
+	for i, f := range fs {
+		if ok, err := f.Verify(); !ok {
+			errs = append(errs, SegmentError{side, i, err.Error()})
+		}
+		if i == 0 {
+			continue
+		}
+
+		prev := fs[i-1]
+		if d := prev.End.Distance(f.Start); d > gJointTolerance {
+			errs = append(errs, SegmentError{side, i, fmt.Sprintf("start %v is %.3f away from previous end %v", f.Start, d, prev.End)})
+			continue
+		}
+		diff := math.Abs(math.Remainder(float64(f.tangentOf(f.Start)-prev.tangentOf(prev.End)), 180))
+		if diff > gTangentTolerance {
+			errs = append(errs, SegmentError{side, i, fmt.Sprintf("tangent turns %.2f degree at joint %v", diff, f.Start)})
+		}
+	}
+	return errs
+}
+
+func sample(side string, fs []Function, interval float64) (ps []util.FloatPoint, err error) {
+	for i, f := range fs {
+		var p util.FloatPoint
+		for n := 0; ; n++ {
+			next, res, err := f.NextPoint(p, interval)
+			if err != nil {
+				return ps, SegmentError{side, i, err.Error()}
+			}
+			if res == NotFount || res == StartPoint && n > 0 {
+				return ps, SegmentError{side, i, fmt.Sprintf("can't advance from %v", p)}
+			}
+			ps = append(ps, next)
+			if res == EndPoint {
+				break
+			}
+			p = next
+		}
+	}
+	return ps, nil
+}
+
+func validateWheelbase(front, rear []util.FloatPoint, wheelbase float64) (errs []error) {
+	if d := front[0].Distance(rear[0]); !util.FloatEqualTolerance(d, wheelbase, gWheelbaseTolerance) {
+		errs = append(errs, fmt.Errorf("Start front %v and rear %v are %.1f apart, want %.0f", front[0], rear[0], d, wheelbase))
+	}
+	f, r := front[len(front)-1], rear[len(rear)-1]
+	if d := f.Distance(r); !util.FloatEqualTolerance(d, wheelbase, gWheelbaseTolerance) {
+		errs = append(errs, fmt.Errorf("End front %v and rear %v are %.1f apart, want %.0f", f, r, d, wheelbase))
+	}
+
+	j := 0
+	for _, f := range front {
+		for j < len(rear)-1 && f.Distance(rear[j+1]) >= wheelbase {
+			j++
+		}
+		if d := f.Distance(rear[j]); d < wheelbase-gWheelbaseTolerance || j == len(rear)-1 && d > wheelbase+gWheelbaseTolerance {
+			errs = append(errs, fmt.Errorf("Front %v has no rear point a wheelbase behind, nearest %v is %.1f apart", f, rear[j], d))
+			break
+		}
+	}
+	return errs
+}
+
+func (t Track) Validate(wheelbase float64) (errs []error) {
+	errs = append(errs, validateSide("front", t.Front)...)
+	errs = append(errs, validateSide("rear", t.Rear)...)
+	if len(t.Front) == 0 || len(t.Rear) == 0 {
+		return errs
+	}
+
+	front, err := sample("front", t.Front, gValidateInterval)
+	if err != nil {
+		return append(errs, err)
+	}
+	rear, err := sample("rear", t.Rear, gValidateInterval)
+	if err != nil {
+		return append(errs, err)
+	}
+	return append(errs, validateWheelbase(front, rear, wheelbase)...)
+}
+
+func (t Track) Wheelbase() float64 {
+	if len(t.Front) == 0 || len(t.Rear) == 0 {
+		return 0
+	}
+	return t.Front[0].Start.Distance(t.Rear[0].Start)
+}
+
+func (qct QuadraticCurveTrack) convert() (Track, error) {
+	t, err := qct.ToTrack()
+	if err != nil {
+		return t, fmt.Errorf("Track %s: can't convert: %s", qct.Name, err)
+	}
+	return t, nil
+}
+
+func (qct QuadraticCurveTrack) Validate(wheelbase float64) error {
+	t, err := qct.convert()
+	if err != nil {
+		return err
+	}
+	return joinErrors(qct.Name, t.Validate(wheelbase))
+}
+
+func ValidateFile(fileName string, wheelbase float64) error {
+	var qct QuadraticCurveTrack
+	if err := qct.LoadFromJSONFile(fileName); err != nil {
+		return err
+	}
+	return qct.Validate(wheelbase)
+}
+
+func joinErrors(name string, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("Track %s: %d errors", name, len(errs))
+	for _, err := range errs {
+		msg += "\n\t" + err.Error()
+	}
+	return fmt.Errorf("%s", msg)
+}
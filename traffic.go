@@ -2,16 +2,21 @@ package traffic
 
 import (
 	"encoding/json"
+	"log"
+	"traffic/legume"
+	"traffic/path"
 	"traffic/route"
+	"traffic/util"
+	"traffic/vehicle"
 )
 
-const AGVWheelbase = 1200
-const ToleranceParallel = 6
-const ToleranceVertical = 11
+const AGVWheelbase = vehicle.DefaultWheelbase
+const ToleranceParallel = vehicle.DefaultToleranceParallel
+const ToleranceVertical = vehicle.DefaultToleranceVertical
 
 type AGVStatus struct {
 	ID, Heading, Speed, MotionStatus, Priority int
-	Pos                                        route.IntPoint
+	Pos                                        util.IntPoint
 	ControlCode                                int
 	Target                                     route.Mark
 }
@@ -26,10 +31,11 @@ func (as AGVStatus) String() string {
 
 type AGVCommand struct {
 	Type, Heading                     int
-	Target                            route.IntPoint
+	Target                            util.IntPoint
 	MaxStraightSpeed, MaxSpecialSpeed int
 	IsNeedAccurateStop                bool
 	CommandRefs                       [7]int
+	Seq                               int
 }
 
 const (
@@ -51,55 +57,84 @@ const (
 	MSSTurn
 )
 
+const (
+	ECNone = iota
+	ECDeadlock
+	ECNoAck
+	ECRoute
+	ECLinkage
+)
+
+// AGVResult carries the last command and the commands sent in the cycle, one
+// per newly claimed sub route or every pending one on retransmission.
 type AGVResult struct {
 	ID, RunStatus int
 	Command       AGVCommand
+	Commands      []AGVCommand
 	ErrorCode     int
+	IsRetransmit  bool
 }
 
 type AGV struct {
 	ID, Heading, Speed, MotionStatus, ControlCode, Priority int
-	Position                                                route.FloatPoint
+	Position                                                util.FloatPoint
 	Routes                                                  []route.SubRoute
-	Orientation                                             route.Direction
+	Orientation                                             util.Direction
 	Current, CommandRM, Claim, Trying, Target               route.Mark
 	Command                                                 AGVCommand
 	RunStatus, TryFailedCount, ErrorCode                    int
+	Model                                                   *vehicle.Model
+	leg                                                     *legume.Legume
+	seq, linkSpeed                                          int
+	pending                                                 []pendingCommand
+	sent                                                    []AGVCommand
+	held                                                    []route.SubRoute
+	heldSeq                                                 int
+	path                                                    *path.Path
+	hooks                                                   *stateHooks
+	history                                                 []Transition
+}
+
+func (v AGV) model() *vehicle.Model {
+	if v.Model == nil {
+		return &vehicle.Default
+	}
+	return v.Model
 }
 
-func (v AGV) IsArrivalWithTolerance(p route.IntPoint) bool {
+func (v AGV) IsArrivalWithTolerance(p util.IntPoint) bool {
 	if v.MotionStatus != MSStop && v.MotionStatus != MSStraight {
 		return false
 	}
 
-	if v.Orientation == route.XInc || v.Orientation == route.XDec {
-		return route.FloatEqualTolerance(v.Position.X, p.ToFloatPoint().X, ToleranceParallel) &&
-			route.FloatEqualTolerance(v.Position.Y, p.ToFloatPoint().Y, ToleranceVertical)
-	} else if v.Orientation == route.YInc || v.Orientation == route.YDec {
-		return route.FloatEqualTolerance(v.Position.X, p.ToFloatPoint().X, ToleranceVertical) &&
-			route.FloatEqualTolerance(v.Position.Y, p.ToFloatPoint().Y, ToleranceParallel)
+	if v.Orientation == util.XInc || v.Orientation == util.XDec {
+		return util.FloatEqualTolerance(v.Position.X, p.ToFloatPoint().X, v.model().ToleranceParallel) &&
+			util.FloatEqualTolerance(v.Position.Y, p.ToFloatPoint().Y, v.model().ToleranceVertical)
+	} else if v.Orientation == util.YInc || v.Orientation == util.YDec {
+		return util.FloatEqualTolerance(v.Position.X, p.ToFloatPoint().X, v.model().ToleranceVertical) &&
+			util.FloatEqualTolerance(v.Position.Y, p.ToFloatPoint().Y, v.model().ToleranceParallel)
 	} else {
 		return false
 	}
 }
 
-func (v AGV) IsAGVOnLineWithTolerance(start, end route.IntPoint) bool {
-	if v.Orientation == route.XInc || v.Orientation == route.XDec && start.Y == end.Y {
-		return route.FloatEqualTolerance(start.ToFloatPoint().Y, v.Position.Y, ToleranceVertical)
-	} else if v.Orientation == route.YInc || v.Orientation == route.YDec && start.X == end.X {
-		return route.FloatEqualTolerance(start.ToFloatPoint().X, v.Position.X, ToleranceVertical)
+func (v AGV) IsAGVOnLineWithTolerance(start, end util.IntPoint) bool {
+	if v.Orientation == util.XInc || v.Orientation == util.XDec && start.Y == end.Y {
+		return util.FloatEqualTolerance(start.ToFloatPoint().Y, v.Position.Y, v.model().ToleranceVertical)
+	} else if v.Orientation == util.YInc || v.Orientation == util.YDec && start.X == end.X {
+		return util.FloatEqualTolerance(start.ToFloatPoint().X, v.Position.X, v.model().ToleranceVertical)
 	} else {
 		return false
 	}
 }
 
-func (v AGV) IsAGVOnSegmentWithTolerance(start, end route.IntPoint) bool {
-	if v.Orientation == route.XInc || v.Orientation == route.XDec && start.Y == end.Y {
-		return route.FloatEqualTolerance(start.ToFloatPoint().Y, v.Position.Y, ToleranceVertical) &&
-			route.FloatInOpenInterval(v.Position.X, start.ToFloatPoint().X, end.ToFloatPoint().X, ToleranceParallel)
-	} else if v.Orientation == route.YInc || v.Orientation == route.YDec && start.X == end.X {
-		return route.FloatEqualTolerance(start.ToFloatPoint().X, v.Position.X, ToleranceVertical) &&
-			route.FloatInOpenInterval(v.Position.Y, start.ToFloatPoint().Y, end.ToFloatPoint().Y, ToleranceParallel)
+func (v AGV) IsAGVOnSegmentWithTolerance(start, end util.IntPoint) bool {
+	if v.Orientation == util.XInc || v.Orientation == util.XDec && start.Y == end.Y {
+		return util.FloatEqualTolerance(start.ToFloatPoint().Y, v.Position.Y, v.model().ToleranceVertical) &&
+			util.FloatInOpenInterval(v.Position.X, start.ToFloatPoint().X, end.ToFloatPoint().X, v.model().ToleranceParallel)
+	} else if v.Orientation == util.YInc || v.Orientation == util.YDec && start.X == end.X {
+		return util.FloatEqualTolerance(start.ToFloatPoint().X, v.Position.X, v.model().ToleranceVertical) &&
+			util.FloatInOpenInterval(v.Position.Y, start.ToFloatPoint().Y, end.ToFloatPoint().Y, v.model().ToleranceParallel)
 	} else {
 		return false
 	}
@@ -109,8 +144,9 @@ func (v AGV) IsAGVOnSubRoute(index int) bool {
 	sr := v.Routes[index]
 
 	switch sr.Type {
-	case route.Straight:
-		if v.IsAGVOnSegmentWithTolerance(sr.Start, sr.End) {
+	case route.Straight, route.Linkage:
+		if v.Orientation == sr.HeadingOnSubRoute(sr.End, sr.IsAstern).ToDirection() &&
+			v.IsAGVOnSegmentWithTolerance(sr.Start, sr.End) {
 			return true
 		}
 
@@ -121,11 +157,11 @@ func (v AGV) IsAGVOnSubRoute(index int) bool {
 
 	case route.Oblique:
 		if sr.Start.X-sr.End.X == int(sr.RefParams[0]) {
-			sr.RefPoints[0] = route.IntPoint{X: sr.Start.X, Y: sr.End.Y}
-			sr.RefPoints[1] = route.IntPoint{X: sr.End.X, Y: sr.Start.Y}
+			sr.RefPoints[0] = util.IntPoint{X: sr.Start.X, Y: sr.End.Y}
+			sr.RefPoints[1] = util.IntPoint{X: sr.End.X, Y: sr.Start.Y}
 		} else {
-			sr.RefPoints[0] = route.IntPoint{X: sr.End.X, Y: sr.Start.Y}
-			sr.RefPoints[1] = route.IntPoint{X: sr.Start.X, Y: sr.End.Y}
+			sr.RefPoints[0] = util.IntPoint{X: sr.End.X, Y: sr.Start.Y}
+			sr.RefPoints[1] = util.IntPoint{X: sr.Start.X, Y: sr.End.Y}
 		}
 
 		if v.IsAGVOnSegmentWithTolerance(sr.Start, sr.RefPoints[0]) || v.IsAGVOnSegmentWithTolerance(sr.End, sr.RefPoints[1]) {
@@ -149,77 +185,49 @@ func (v AGV) IsAGVOnSubRoute(index int) bool {
 	return false
 }
 
-func (v AGV) UpdateCurrentMark() {
+func (v *AGV) UpdateCurrentMark() {
 	if v.Current.Index == v.Claim.Index {
 		return
 	}
 
-	newIdx := v.Current.Index
-	switch v.MotionStatus {
-	case MSStop:
-		fallthrough
-	case MSStraight:
-		for i := newIdx; i < v.Claim.Index; i++ {
-			if v.IsAGVOnSubRoute(i) {
-				if v.IsArrivalWithTolerance(v.Routes[i].End) && i < v.Claim.Index {
-					newIdx = i + 1
-				} else {
-					newIdx = i
-				}
-				break
-			}
-		}
-
-	case MSQTurn:
-		if v.Current.Index < v.CommandRM.Index+1 {
-			sr := v.Routes[v.Current.Index+1]
-			if sr.Type == route.QTurn &&
-				route.FloatInCloseInterval(v.Position.X, sr.Start.ToFloatPoint().X, sr.End.ToFloatPoint().X, 0.3) &&
-				route.FloatInCloseInterval(v.Position.Y, sr.Start.ToFloatPoint().Y, sr.End.ToFloatPoint().Y, 0.3) {
-				newIdx = v.Current.Index + 1
-			}
-		}
-
-	case MSOblique:
-		if v.Current.Index < v.Claim.Index+1 {
-			if v.Routes[v.Current.Index+1].Type == route.Oblique {
-				newIdx = v.Current.Index + 1
-			}
-		}
-
-	case MSUTurn:
-		if v.Current.Index < v.Claim.Index+1 {
-			if v.Routes[v.Current.Index+1].Type == route.UTurn {
-				newIdx = v.Current.Index + 1
-			}
-		}
-
-	case MSSTurn:
-		if v.Current.Index < v.Claim.Index+1 {
-			if v.Routes[v.Current.Index+1].Type == route.STurn {
-				newIdx = v.Current.Index + 1
-			}
-		}
-
-	default:
+	pr, ok := v.Progress()
+	if !ok {
 		return
 	}
 
-	v.Current.Index = newIdx
+	newIdx := pr.Index
+	if v.path.Bounds[pr.Index+1]-v.path.Bounds[pr.Index]-pr.Offset <= v.model().ToleranceParallel {
+		newIdx++
+	}
+	if newIdx > v.Claim.Index {
+		newIdx = v.Claim.Index
+	}
+	if newIdx > v.Current.Index {
+		v.Current.Index = newIdx
+	}
 }
 
-func (v AGV) Reset() {
+func (v *AGV) Reset() {
 	v.Current.Index = 0
 	v.Claim.Index = 0
 	v.Target.Index = 0
 	v.CommandRM.Index = 0
 
 	v.Claim.Position = v.Position.ToIntPoint()
+	v.pending = nil
+	v.sent = nil
+	v.held, v.heldSeq = nil, 0
+	v.path = nil
 
-	v.RunStatus = Idle
+	if err := v.Transit(Idle, "reset"); err != nil {
+		log.Printf("<AGV.Reset> %s\n", err)
+	}
 }
 
-func (v AGV) ResetTrying() {
+func (v *AGV) ResetTrying() {
 	v.Trying = v.Claim
 	v.TryFailedCount = 0
+	if v.leg != nil {
+		v.leg.ResetTrying()
+	}
 }
@@ -94,3 +94,103 @@ func (d Degree) SymmetryXAxis() Degree {
 func (s Slope) ToDegree() Degree {
 	return Degree(math.Mod(180*math.Atan(float64(s))/math.Pi, 360))
 }
+
+func (d Degree) ToDirection() Direction {
+	n := d.Normalize()
+
+	switch {
+	case n < 45 || n >= 315:
+		return XInc
+	case n < 135:
+		return YInc
+	case n < 225:
+		return XDec
+	default:
+		return YDec
+	}
+}
+
+func (d Direction) Unit() FloatPoint {
+	switch d {
+	case XInc:
+		return FloatPoint{1, 0}
+	case XDec:
+		return FloatPoint{-1, 0}
+	case YInc:
+		return FloatPoint{0, 1}
+	case YDec:
+		return FloatPoint{0, -1}
+	default:
+		return FloatPointZero
+	}
+}
+
+func IsLeftTurn(d1, d2 Direction) bool {
+	u := d1.Unit()
+	w := d2.Unit()
+	return u.X*w.Y-u.Y*w.X >= 0
+}
+
+func (d Degree) Normalize() Degree {
+	n := math.Mod(float64(d), 360)
+	if n < 0 {
+		n += 360
+	}
+	return Degree(n)
+}
+
+func (d Degree) Transform(d1, d2 Direction) Degree {
+	return NewSymmetry(d1, d2).Degree(d)
+}
+
+// Symmetry is one of the 8 symmetries of the grid, a mirror on the X axis if
+// IsMirror, then the rotation taking XInc to Rotation.
+type Symmetry struct {
+	Rotation Direction
+	IsMirror bool
+}
+
+var Identity = Symmetry{Rotation: XInc}
+
+// NewSymmetry returns the symmetry taking the base turn from XInc to YInc onto
+// the turn from d1 to d2.
+func NewSymmetry(d1, d2 Direction) Symmetry {
+	return Symmetry{Rotation: d1, IsMirror: !IsLeftTurn(d1, d2)}
+}
+
+func Symmetries() (ss []Symmetry) {
+	for _, d := range []Direction{XInc, YInc, XDec, YDec} {
+		ss = append(ss, Symmetry{Rotation: d}, Symmetry{Rotation: d, IsMirror: true})
+	}
+	return ss
+}
+
+func (s Symmetry) String() string {
+	if s.IsMirror {
+		return "Mirror" + s.Rotation.String()
+	}
+	return s.Rotation.String()
+}
+
+func (s Symmetry) Point(p FloatPoint) FloatPoint {
+	return p.Rotate(s.Rotation, !s.IsMirror)
+}
+
+func (s Symmetry) Degree(d Degree) Degree {
+	if s.IsMirror {
+		d = -d
+	}
+	return (d + s.Rotation.ToDegree()).Normalize()
+}
+
+func (s Symmetry) Direction(d Direction) Direction {
+	return s.Degree(d.ToDegree()).ToDirection()
+}
+
+// Inverse undoes s, a mirrored symmetry is a reflection and its own inverse.
+func (s Symmetry) Inverse() Symmetry {
+	if s.IsMirror {
+		return s
+	}
+	return Symmetry{Rotation: (-s.Rotation.ToDegree()).ToDirection()}
+}
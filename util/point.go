@@ -75,3 +75,16 @@ func (f FloatPoint) SymmetryYAxis() FloatPoint {
 func (f FloatPoint) SymmetryOrigin() FloatPoint {
 	return FloatPoint{-f.X, -f.Y}
 }
+
+func (f FloatPoint) Rotate(d Direction, isLeft bool) FloatPoint {
+	u := d.Unit()
+	v := FloatPoint{-u.Y, u.X}
+	if !isLeft {
+		v = v.SymmetryOrigin()
+	}
+	return FloatPoint{f.X*u.X + f.Y*v.X, f.X*u.Y + f.Y*v.Y}
+}
+
+func (f FloatPoint) Transform(d1, d2 Direction) FloatPoint {
+	return NewSymmetry(d1, d2).Point(f)
+}
@@ -1,9 +1,34 @@
 package util
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestFloatEqual(t *testing.T) {
 	if FloatEqual(-0.005422689076629065, 0) == false {
 		t.Error("")
 	}
 }
+
+func TestSymmetry(t *testing.T) {
+	p := FloatPoint{X: 300, Y: 100}
+	for _, s := range Symmetries() {
+		q := s.Point(p)
+		u := s.Point(FloatPoint{X: math.Sqrt(3), Y: 1})
+		if deg := s.Degree(30); !deg.Equal(Degree(math.Atan2(u.Y, u.X) * 180 / math.Pi).Normalize()) {
+			t.Errorf("%s: want degree consistent with point, result %v", s, deg)
+		}
+		if r := s.Inverse().Point(q); !r.Equal(p) {
+			t.Errorf("%s: want inverse back at %v, result %v", s, p, r)
+		}
+	}
+
+	s := NewSymmetry(XDec, YInc)
+	if !s.IsMirror || s.Direction(XInc) != XDec || s.Direction(YInc) != YInc {
+		t.Errorf("want XDec to YInc a mirrored turn, result %s", s)
+	}
+	if q := s.Point(FloatPoint{X: 300, Y: 100}); !q.Equal(FloatPoint{X: -300, Y: 100}) {
+		t.Errorf("want (-300, 100), result %v", q)
+	}
+}
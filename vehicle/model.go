@@ -0,0 +1,189 @@
+package vehicle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"traffic/route"
+	"traffic/track"
+)
+
+const (
+	DefaultWheelbase              = 1200
+	DefaultHalfLength             = 850
+	DefaultHalfWidth              = 170
+	DefaultToleranceParallel      = 6
+	DefaultToleranceVertical      = 11
+	DefaultMaxLateralAcceleration = 500 // mm/s^2
+)
+
+const gModelVersion = 1
+
+type OBBSize struct {
+	Front, Rear, Inner, Outer float64
+}
+
+type Model struct {
+	Name                                       string
+	Wheelbase                                  float64
+	HalfLength, HalfWidth                      float64
+	ToleranceParallel, ToleranceVertical       float64
+	MaxSpeed, MaxAcceleration, MaxDeceleration int
+	MaxLateralAcceleration                     float64 `json:",omitempty"`
+	Steering                                   track.Steering
+	OBBSizes                                   map[int]OBBSize
+}
+
+var Default = Model{
+	Name:                   "default",
+	Wheelbase:              DefaultWheelbase,
+	HalfLength:             DefaultHalfLength,
+	HalfWidth:              DefaultHalfWidth,
+	ToleranceParallel:      DefaultToleranceParallel,
+	ToleranceVertical:      DefaultToleranceVertical,
+	MaxLateralAcceleration: DefaultMaxLateralAcceleration,
+}
+
+func (m Model) String() string {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+func (m Model) Validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("Model without name")
+	}
+	if m.Wheelbase <= 0 || m.HalfLength <= 0 || m.HalfWidth <= 0 {
+		return fmt.Errorf("Model %s: wheelbase and body must be positive", m.Name)
+	}
+	if m.Wheelbase > 2*m.HalfLength {
+		return fmt.Errorf("Model %s: wheelbase %.0f longer than body %.0f", m.Name, m.Wheelbase, 2*m.HalfLength)
+	}
+	if m.ToleranceParallel <= 0 || m.ToleranceVertical <= 0 {
+		return fmt.Errorf("Model %s: tolerance must be positive", m.Name)
+	}
+	if m.MaxSpeed < 0 || m.MaxAcceleration < 0 || m.MaxDeceleration < 0 || m.MaxLateralAcceleration < 0 {
+		return fmt.Errorf("Model %s: negative speed limit", m.Name)
+	}
+
+	if m.Steering != track.SteerFront && m.Steering != track.SteerCoordinated {
+		return fmt.Errorf("Model %s: unsupported steering %s", m.Name, m.Steering)
+	}
+
+	for id, size := range m.OBBSizes {
+		if size.Front <= 0 || size.Rear <= 0 || size.Inner <= 0 || size.Outer <= 0 {
+			return fmt.Errorf("Model %s: move type %d OBB size must be positive", m.Name, id)
+		}
+	}
+	return nil
+}
+
+func (m Model) OBBSize(moveTypeID int) (OBBSize, bool) {
+	size, ok := m.OBBSizes[moveTypeID]
+	return size, ok
+}
+
+// TurnSpeed returns the speed limit of a turn from its curvature, the track
+// of a QTurn or the ref points of a UTurn and STurn, 0 if the sub route isn't
+// limited by geometry.
+func (m Model) TurnSpeed(sr route.SubRoute) (int, error) {
+	if m.MaxLateralAcceleration <= 0 {
+		return 0, nil
+	}
+
+	var v float64
+	switch sr.Type {
+	case route.QTurn:
+		var err error
+		if v, err = track.SpeedLimit(sr.MoveType, m.MaxLateralAcceleration); err != nil {
+			return 0, err
+		}
+
+	case route.UTurn, route.STurn:
+		k, err := sr.MaxCurvature()
+		if err != nil {
+			return 0, err
+		}
+		v = track.LateralSpeed(k, m.MaxLateralAcceleration)
+
+	default:
+		return 0, nil
+	}
+
+	if math.IsInf(v, 1) {
+		return 0, nil
+	}
+	return int(math.Max(1, math.Floor(v))), nil
+}
+
+func (m Model) Limit(sr route.SubRoute) route.SubRoute {
+	sr.MaxSpeed = limit(sr.MaxSpeed, m.MaxSpeed)
+	if v, err := m.TurnSpeed(sr); err != nil {
+		log.Printf("<Model.Limit> model %s, move type %d: %s\n", m.Name, sr.MoveType, err)
+	} else {
+		sr.MaxSpeed = limit(sr.MaxSpeed, v)
+	}
+	sr.MaxAcceleration = limit(sr.MaxAcceleration, m.MaxAcceleration)
+	sr.MaxDeceleration = limit(sr.MaxDeceleration, m.MaxDeceleration)
+	return sr
+}
+
+func limit(a, max int) int {
+	if max > 0 && (a <= 0 || a > max) {
+		return max
+	}
+	return a
+}
+
+func (m Model) ValidateTrack(moveTypeID int) error {
+	return track.ValidateMoveType(moveTypeID, m.Wheelbase)
+}
+
+func (m Model) GenerateRear(qct *track.QuadraticCurveTrack, tolerance float64) ([]track.FitSegment, error) {
+	return qct.GenerateRear(m.Wheelbase, m.Steering, tolerance)
+}
+
+type catalog struct {
+	Version int
+	Models  []Model
+}
+
+func LoadModels(fileName string) (map[string]*Model, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var c catalog
+	if err = json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Version != gModelVersion {
+		return nil, fmt.Errorf("Models %s: unsupported version %d, want %d", fileName, c.Version, gModelVersion)
+	}
+
+	models := make(map[string]*Model)
+	for i := range c.Models {
+		m := &c.Models[i]
+		if err = m.Validate(); err != nil {
+			return nil, err
+		}
+		if _, ok := models[m.Name]; ok {
+			return nil, fmt.Errorf("Models %s: duplicate model %s", fileName, m.Name)
+		}
+		models[m.Name] = m
+	}
+	return models, nil
+}
@@ -0,0 +1,106 @@
+package vehicle
+
+import (
+	"testing"
+	"traffic/route"
+	"traffic/track"
+	"traffic/util"
+)
+
+func TestLoadModels(t *testing.T) {
+	models, err := LoadModels("data/models.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, ok := models["heavy"]
+	if !ok || m.Wheelbase != 2000 || m.MaxSpeed != 800 {
+		t.Errorf("want heavy model, result %v", models)
+	}
+	if d := models["default"]; d == nil || d.Wheelbase != Default.Wheelbase || d.HalfLength != Default.HalfLength {
+		t.Errorf("want default model same as built in, result %v", d)
+	}
+}
+
+func TestModel_Validate(t *testing.T) {
+	if err := Default.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	m := Default
+	m.Wheelbase = 2000
+	if m.Validate() == nil {
+		t.Error("want error for wheelbase longer than body")
+	}
+
+	m = Default
+	m.OBBSizes = map[int]OBBSize{10: {Front: 1000}}
+	if m.Validate() == nil {
+		t.Error("want error for zero OBB size")
+	}
+}
+
+func TestModel_ValidateTrack(t *testing.T) {
+	if err := Default.ValidateTrack(10); err != nil {
+		t.Error(err)
+	}
+
+	m := Default
+	m.Wheelbase, m.HalfLength = 2000, 1400
+	if m.ValidateTrack(10) == nil {
+		t.Error("want error for track of another wheelbase")
+	}
+}
+
+func TestModel_Limit(t *testing.T) {
+	m := Default
+	m.MaxSpeed, m.MaxAcceleration = 800, 200
+
+	sr := m.Limit(route.SubRoute{MaxSpeed: 1500, MaxAcceleration: 100})
+	if sr.MaxSpeed != 800 || sr.MaxAcceleration != 100 || sr.MaxDeceleration != 0 {
+		t.Errorf("want limited by model, result %s", sr)
+	}
+
+	m.MaxLateralAcceleration = 300
+	sr = m.Limit(route.SubRoute{Type: route.QTurn, MoveType: 10, MaxSpeed: 1500})
+	if v, err := m.TurnSpeed(sr); err != nil || v <= 0 || v >= 800 || sr.MaxSpeed != v {
+		t.Errorf("want turn limited by curvature, result %s %d %v", sr, v, err)
+	}
+	if sr = m.Limit(route.SubRoute{Type: route.Straight, MoveType: 10, MaxSpeed: 1500}); sr.MaxSpeed != 800 {
+		t.Errorf("want straight unaffected by curvature, result %s", sr)
+	}
+
+	// sqrt(300 * 1000) on a UTurn of radius 1000
+	uturn := route.SubRoute{Type: route.UTurn, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 0, Y: 2000}, MaxSpeed: 1500,
+		RefPoints: [2]util.IntPoint{{X: 1000, Y: 0}, {X: 1000, Y: 2000}}}
+	if sr = m.Limit(uturn); sr.MaxSpeed != 547 {
+		t.Errorf("want UTurn limited to 547, result %s", sr)
+	}
+	sturn := route.SubRoute{Type: route.STurn, Start: util.IntPoint{X: 0, Y: 0}, End: util.IntPoint{X: 5000, Y: 1000}, MaxSpeed: 1500,
+		RefPoints: [2]util.IntPoint{{X: 1000, Y: 0}, {X: 4000, Y: 1000}}}
+	if sr = m.Limit(sturn); sr.MaxSpeed <= 0 || sr.MaxSpeed >= 800 {
+		t.Errorf("want STurn limited by curvature, result %s", sr)
+	}
+
+	if v, err := Default.TurnSpeed(route.SubRoute{Type: route.QTurn, MoveType: 10}); err != nil || v <= 0 {
+		t.Errorf("want default model limit turns, result %d %v", v, err)
+	}
+}
+
+func TestModel_GenerateRear(t *testing.T) {
+	qct := track.QuadraticCurveTrack{Name: "Straight", MoveType: 97, Front: track.QuadraticCurveArray{
+		{StartPoint: util.FloatPoint{X: -700, Y: 100}, EndPoint: util.FloatPoint{X: 300, Y: 100}},
+	}}
+
+	m := Default
+	m.Steering = track.SteerCoordinated
+	if _, err := m.GenerateRear(&qct, 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(qct.Rear) == 0 || !qct.Rear[0].StartPoint.Equal(util.FloatPoint{X: -1900, Y: 100}) {
+		t.Errorf("want rear starting a wheelbase behind, result %v", qct.Rear)
+	}
+	if err := qct.Validate(m.Wheelbase); err != nil {
+		t.Error(err)
+	}
+}